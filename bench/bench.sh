@@ -0,0 +1,60 @@
+#!/bin/bash
+#
+# Compares the link time of the working tree against another revision
+# by statically linking a hello world program against libc.a.
+#
+# usage: bench/bench.sh [base-revision]    (default: HEAD~1)
+
+set -e
+
+base=${1:-HEAD~1}
+runs=${RUNS:-20}
+CC=${CC:-riscv64-linux-gnu-gcc}
+
+t=out/bench
+rm -rf "$t"
+mkdir -p "$t"/base "$t"/head
+
+git worktree add -q --detach "$t"/src "$base"
+trap 'git worktree remove --force "$t"/src' EXIT
+
+(cd "$t"/src && go build -o ../base/rvld)
+go build -o "$t"/head/rvld
+ln -sf rvld "$t"/base/ld
+ln -sf rvld "$t"/head/ld
+
+cat <<EOF | $CC -o "$t"/a.o -c -xc -
+#include <stdio.h>
+
+int main(void) {
+    printf("Hello, World\n");
+    return 0;
+}
+EOF
+
+link() {
+  $CC -B"$t/$1" -static "$t"/a.o -o "$t/$1"/out
+}
+
+measure() {
+  link "$1"
+  local start end
+  start=$(date +%s%N)
+  for ((i = 0; i < runs; i++)); do
+    link "$1"
+  done
+  end=$(date +%s%N)
+  echo $(((end - start) / runs / 1000000))
+}
+
+if command -v hyperfine >/dev/null; then
+  hyperfine -w 3 -r "$runs" \
+    -n "$base" "$CC -B$t/base -static $t/a.o -o $t/base/out" \
+    -n "HEAD" "$CC -B$t/head -static $t/a.o -o $t/head/out"
+else
+  b=$(measure base)
+  h=$(measure head)
+  echo "$base: $b ms/link"
+  echo "HEAD: $h ms/link"
+  awk -v b="$b" -v h="$h" 'BEGIN { printf "speedup: %.2fx\n", b / h }'
+fi
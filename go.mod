@@ -1,3 +1,5 @@
 module github.com/ksco/rvld
 
 go 1.19
+
+require github.com/klauspost/compress v1.17.4
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ksco/rvld/pkg/utils"
+	"os"
+	"strings"
+)
+
+// option is one entry of the command line table. A long option may be
+// written with one or two dashes, and its argument follows either "="
+// or as the next word. A single-letter option takes one dash, and its
+// argument may also be joined to it, as in -lfoo.
+type option struct {
+	names  []string
+	hasArg bool
+	fn     func(arg string)
+}
+
+// match reports how many words of args the option consumes, or 0 if it
+// doesn't match. Joined arguments of single-letter options are only
+// accepted when joined is set, so that a long option such as -static
+// is never taken for -s followed by "tatic".
+func (o *option) match(args []string, joined bool) (string, int) {
+	for _, name := range o.names {
+		dashes := []string{"-" + name}
+		if len(name) > 1 {
+			dashes = append(dashes, "--"+name)
+		}
+
+		for _, opt := range dashes {
+			if joined {
+				if len(name) == 1 && o.hasArg &&
+					strings.HasPrefix(args[0], opt) && len(args[0]) > len(opt) {
+					return args[0][len(opt):], 1
+				}
+				continue
+			}
+
+			if args[0] == opt {
+				if !o.hasArg {
+					return "", 1
+				}
+				if len(args) == 1 {
+					utils.Fatal(fmt.Sprintf("option -%s: argument missing", name))
+				}
+				return args[1], 2
+			}
+
+			if len(name) > 1 && o.hasArg {
+				if val, ok := utils.RemovePrefix(args[0], opt+"="); ok {
+					return val, 1
+				}
+			}
+		}
+	}
+	return "", 0
+}
+
+// parseOptions runs the handler of every option in args. Words that
+// don't start with a dash are passed to input, and options that aren't
+// in the table to unknown. Every option name is tried before a word is
+// split into a single-letter option and a joined argument.
+func parseOptions(args []string, table []option, input, unknown func(string)) {
+	for len(args) > 0 {
+		if !strings.HasPrefix(args[0], "-") || args[0] == "-" {
+			input(args[0])
+			args = args[1:]
+			continue
+		}
+
+		n := 0
+		for _, joined := range []bool{false, true} {
+			for i := range table {
+				var arg string
+				if arg, n = table[i].match(args, joined); n > 0 {
+					table[i].fn(arg)
+					break
+				}
+			}
+			if n > 0 {
+				break
+			}
+		}
+
+		if n == 0 {
+			unknown(args[0])
+			n = 1
+		}
+		args = args[n:]
+	}
+}
+
+// expandResponseFiles replaces each @file argument with the words of
+// that file, recursively. As in GNU tools, an @file that can't be read
+// is left as it is.
+func expandResponseFiles(args []string) []string {
+	out := make([]string, 0, len(args))
+	for depth := 0; ; depth++ {
+		expanded := false
+		for _, arg := range args {
+			name, ok := utils.RemovePrefix(arg, "@")
+			if !ok || name == "" {
+				out = append(out, arg)
+				continue
+			}
+
+			contents, err := os.ReadFile(name)
+			if err != nil {
+				out = append(out, arg)
+				continue
+			}
+			out = append(out, splitResponseFile(string(contents))...)
+			expanded = true
+		}
+
+		if !expanded {
+			return out
+		}
+		if depth == 100 {
+			utils.Fatal("too many levels of response files")
+		}
+		args, out = out, make([]string, 0, len(out))
+	}
+}
+
+// splitResponseFile splits the contents of a response file into words
+// with the quoting rules of libiberty's buildargv: words are separated
+// by white space, single and double quotes group characters, and a
+// backslash takes the next character literally.
+func splitResponseFile(s string) []string {
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	quote := byte(0)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case strings.IndexByte(" \t\n\r\v\f", c) >= 0:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
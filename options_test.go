@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitResponseFile(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{" \t\n", []string{}},
+		{"-o out a.o", []string{"-o", "out", "a.o"}},
+		{"a.o\nb.o\r\n\tc.o", []string{"a.o", "b.o", "c.o"}},
+		{`'with space/a.o'`, []string{"with space/a.o"}},
+		{`"with space"/b.o`, []string{"with space/b.o"}},
+		{`with\ space`, []string{"with space"}},
+		{`'it''s'`, []string{"its"}},
+		{`"a'b" 'a"b'`, []string{"a'b", `a"b`}},
+		{`"a\"b"`, []string{`a"b`}},
+		{`'' ""`, []string{"", ""}},
+		{`a\`, []string{`a\`}},
+		{`'unterminated`, []string{"unterminated"}},
+	}
+
+	for _, test := range tests {
+		got := splitResponseFile(test.in)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitResponseFile(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		inputs []string
+	}{
+		{[]string{"-export-dynamic-symbol", "foo", "a.o"}, []string{"a.o"}},
+		{[]string{"--export-dynamic-symbol", "foo", "a.o"}, []string{"a.o"}},
+		{[]string{"--export-dynamic-symbol=foo", "a.o"}, []string{"a.o"}},
+		{[]string{"-e", "main", "a.o", "-lfoo"}, []string{"a.o", "-lfoo"}},
+		{[]string{"-rpath", "/x", "a.o", "-soname", "libx.so"}, []string{"a.o"}},
+	}
+
+	for _, test := range tests {
+		cfg := parseArgs(test.args)
+		got := make([]string, 0)
+		for _, input := range cfg.Inputs {
+			got = append(got, input.Name)
+		}
+		if !reflect.DeepEqual(got, test.inputs) {
+			t.Errorf("parseArgs(%q) has inputs %q, want %q", test.args, got, test.inputs)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package linker
 import "github.com/ksco/rvld/pkg/utils"
 
 func ReadArchiveMembers(file *File) []*File {
-	utils.Assert(GetFileType(file.Contents) == FileTypeArchive)
+	assert(GetFileType(file.Contents) == FileTypeArchive)
 
 	pos := 8
 	var strTab []byte
@@ -0,0 +1,138 @@
+package linker
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"github.com/ksco/rvld/pkg/utils"
+	"strings"
+)
+
+type BuildIdKind = uint8
+
+const (
+	BuildIdKindNone BuildIdKind = iota
+	BuildIdKindSha1
+	BuildIdKindMd5
+	BuildIdKindFast
+	BuildIdKindUuid
+	BuildIdKindHex
+)
+
+type BuildId struct {
+	Kind  BuildIdKind
+	Value []byte
+}
+
+func ParseBuildId(arg string) (BuildId, bool) {
+	switch arg {
+	case "none":
+		return BuildId{Kind: BuildIdKindNone}, true
+	case "sha1", "tree":
+		return BuildId{Kind: BuildIdKindSha1}, true
+	case "md5":
+		return BuildId{Kind: BuildIdKindMd5}, true
+	case "fast":
+		return BuildId{Kind: BuildIdKindFast}, true
+	case "uuid":
+		return BuildId{Kind: BuildIdKindUuid}, true
+	}
+
+	if s, ok := utils.RemovePrefix(strings.ToLower(arg), "0x"); ok {
+		val, err := hex.DecodeString(s)
+		if err == nil && len(val) > 0 {
+			return BuildId{Kind: BuildIdKindHex, Value: val}, true
+		}
+	}
+
+	return BuildId{}, false
+}
+
+func (b *BuildId) Size() int {
+	switch b.Kind {
+	case BuildIdKindSha1:
+		return sha1.Size
+	case BuildIdKindMd5, BuildIdKindFast, BuildIdKindUuid:
+		return 16
+	case BuildIdKindHex:
+		return len(b.Value)
+	}
+	return 0
+}
+
+const buildIdHeaderSize = 16
+
+type BuildIdSection struct {
+	Chunk
+}
+
+func NewBuildIdSection() *BuildIdSection {
+	b := &BuildIdSection{Chunk: NewChunk()}
+	b.Name = ".note.gnu.build-id"
+	b.Shdr.Type = uint32(elf.SHT_NOTE)
+	b.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	b.Shdr.AddrAlign = 4
+	return b
+}
+
+func (b *BuildIdSection) UpdateShdr(ctx *Context) {
+	b.Shdr.Size = buildIdHeaderSize +
+		utils.AlignTo(uint64(ctx.Args.BuildId.Size()), 4)
+}
+
+func (b *BuildIdSection) CopyBuf(ctx *Context) {
+	buf := ctx.Buf[b.Shdr.Offset:]
+	utils.Write[uint32](buf, 4)
+	utils.Write[uint32](buf[4:], uint32(ctx.Args.BuildId.Size()))
+	utils.Write[uint32](buf[8:], NT_GNU_BUILD_ID)
+	copy(buf[12:], "GNU\x00")
+}
+
+// WriteBuildId fills in the note descriptor. It has to run after every
+// other chunk has been copied, since most kinds hash the whole image
+// (with the descriptor still zero).
+func (b *BuildIdSection) WriteBuildId(ctx *Context) {
+	desc := ctx.Buf[b.Shdr.Offset+buildIdHeaderSize:]
+	size := ctx.Args.BuildId.Size()
+
+	switch ctx.Args.BuildId.Kind {
+	case BuildIdKindSha1:
+		sum := sha1.Sum(ctx.Buf)
+		copy(desc, sum[:size])
+	case BuildIdKindMd5:
+		sum := md5.Sum(ctx.Buf)
+		copy(desc, sum[:size])
+	case BuildIdKindFast:
+		sum := treeHash(ctx, ctx.Buf)
+		copy(desc, sum[:size])
+	case BuildIdKindUuid:
+		_, err := rand.Read(desc[:size])
+		mustNo(err)
+		desc[6] = desc[6]&0x0f | 0x40
+		desc[8] = desc[8]&0x3f | 0x80
+	case BuildIdKindHex:
+		copy(desc, ctx.Args.BuildId.Value)
+	}
+}
+
+// treeHash splits data into fixed-size shards, hashes them in parallel
+// and then hashes the concatenation of the shard digests.
+func treeHash(ctx *Context, data []byte) [sha256.Size]byte {
+	const shardSize = 1 << 20
+
+	numShards := (len(data) + shardSize - 1) / shardSize
+	digests := make([]byte, numShards*sha256.Size)
+	ctx.ParallelFor(numShards, func(i int) {
+		end := (i + 1) * shardSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[i*shardSize : end])
+		copy(digests[i*sha256.Size:], sum[:])
+	})
+
+	return sha256.Sum256(digests)
+}
@@ -3,6 +3,8 @@ package linker
 type Chunker interface {
 	GetName() string
 	GetShdr() *Shdr
+	GetShndx() int64
+	SetShndx(shndx int64)
 	UpdateShdr(ctx *Context)
 	CopyBuf(ctx *Context)
 }
@@ -25,6 +27,14 @@ func (c *Chunk) GetShdr() *Shdr {
 	return &c.Shdr
 }
 
+func (c *Chunk) GetShndx() int64 {
+	return c.Shndx
+}
+
+func (c *Chunk) SetShndx(shndx int64) {
+	c.Shndx = shndx
+}
+
 func (c *Chunk) UpdateShdr(ctx *Context) {}
 
 func (c *Chunk) CopyBuf(ctx *Context) {}
@@ -0,0 +1,18 @@
+package linker
+
+type ComdatGroup struct {
+	Owner *ObjectFile
+}
+
+type ComdatGroupRef struct {
+	Group   *ComdatGroup
+	SymIdx  uint32
+	Members []uint32
+}
+
+func GetComdatGroupByName(ctx *Context, name string) *ComdatGroup {
+	group, _ := ctx.ComdatGroups.GetOrInsert(name, func() *ComdatGroup {
+		return &ComdatGroup{}
+	})
+	return group
+}
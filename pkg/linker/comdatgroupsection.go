@@ -0,0 +1,61 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+)
+
+// ComdatGroupSection reproduces an input SHT_GROUP section in a
+// relocatable output. Its members are the output sections that were
+// created for the group's input sections, plus their relocations.
+type ComdatGroupSection struct {
+	Chunk
+	File    *ObjectFile
+	SymIdx  uint32
+	Members []Chunker
+}
+
+func NewComdatGroupSection(ctx *Context, file *ObjectFile,
+	ref ComdatGroupRef, relocs map[*OutputSection]*RelocSection) *ComdatGroupSection {
+	g := &ComdatGroupSection{Chunk: NewChunk(), File: file, SymIdx: ref.SymIdx}
+	g.Name = ".group"
+	g.Shdr.Type = uint32(elf.SHT_GROUP)
+	g.Shdr.AddrAlign = 4
+	g.Shdr.EntSize = 4
+
+	for _, idx := range ref.Members {
+		isec := file.Sections[idx]
+		if isec == nil || !isec.IsAlive {
+			continue
+		}
+
+		g.Members = append(g.Members, isec.OutputSection)
+		if r, ok := relocs[isec.OutputSection]; ok {
+			g.Members = append(g.Members, r)
+		}
+	}
+
+	g.Shdr.Size = uint64(len(g.Members)+1) * 4
+	return g
+}
+
+func (g *ComdatGroupSection) UpdateShdr(ctx *Context) {
+	g.Shdr.Link = uint32(ctx.Symtab.Shndx)
+
+	esym := &g.File.ElfSyms[g.SymIdx]
+	if esym.Type() == uint8(elf.STT_SECTION) {
+		isec := g.File.GetSection(esym, int(g.SymIdx))
+		g.Shdr.Info = ctx.Symtab.SectionSyms[isec.OutputSection]
+	} else {
+		g.Shdr.Info = uint32(g.File.Symbols[g.SymIdx].SymtabIdx)
+	}
+}
+
+func (g *ComdatGroupSection) CopyBuf(ctx *Context) {
+	entries := make([]uint32, 0, len(g.Members)+1)
+	entries = append(entries, GRP_COMDAT)
+	for _, chunk := range g.Members {
+		entries = append(entries, uint32(chunk.GetShndx()))
+	}
+	utils.WriteSlice(ctx.Buf[g.Shdr.Offset:], entries)
+}
@@ -0,0 +1,55 @@
+package linker
+
+import "debug/elf"
+
+// ChunkWriter is a chunk that can render its contents into any buffer,
+// not just its own place in the output file.
+type ChunkWriter interface {
+	Chunker
+	WriteTo(ctx *Context, buf []byte)
+}
+
+// CompressedSection stands in for a non-alloc section in the output,
+// holding an ELF compression header followed by the compressed
+// contents of the original.
+type CompressedSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewCompressedSection(ctx *Context, chunk ChunkWriter) *CompressedSection {
+	shdr := chunk.GetShdr()
+	data := make([]byte, shdr.Size)
+	chunk.WriteTo(ctx, data)
+
+	chdr := Chdr{
+		Type:      uint32(elf.COMPRESS_ZLIB),
+		Size:      shdr.Size,
+		AddrAlign: shdr.AddrAlign,
+	}
+	if ctx.Args.CompressDebugSections == CompressionTypeZstd {
+		chdr.Type = ELFCOMPRESS_ZSTD
+	}
+
+	compressed, err := compress(ctx.Args.CompressDebugSections, data)
+	if err != nil {
+		fail(&LinkError{Section: chunk.GetName(), Err: err})
+	}
+
+	contents := make([]byte, GetChdrSize(ctx.Class()))
+	WriteChdr(ctx.Class(), contents, chdr)
+	contents = append(contents, compressed...)
+
+	c := &CompressedSection{Chunk: NewChunk(), Contents: contents}
+	c.Name = chunk.GetName()
+	c.Shndx = chunk.GetShndx()
+	c.Shdr = *shdr
+	c.Shdr.Flags |= uint64(elf.SHF_COMPRESSED)
+	c.Shdr.Size = uint64(len(contents))
+	c.Shdr.AddrAlign = ctx.WordSize()
+	return c
+}
+
+func (c *CompressedSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[c.Shdr.Offset:], c.Contents)
+}
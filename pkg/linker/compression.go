@@ -0,0 +1,70 @@
+package linker
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"github.com/ksco/rvld/pkg/utils"
+	"io"
+)
+
+type CompressionType = uint8
+
+const (
+	CompressionTypeNone CompressionType = iota
+	CompressionTypeZlib
+	CompressionTypeZstd
+)
+
+func ParseCompressionType(arg string) (CompressionType, bool) {
+	switch arg {
+	case "none":
+		return CompressionTypeNone, true
+	case "zlib", "zlib-gabi":
+		return CompressionTypeZlib, true
+	case "zstd":
+		return CompressionTypeZstd, true
+	}
+	return CompressionTypeNone, false
+}
+
+func decompress(chdr Chdr, data []byte) ([]byte, error) {
+	switch chdr.Type {
+	case uint32(elf.COMPRESS_ZLIB):
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, chdr.Size)
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case ELFCOMPRESS_ZSTD:
+		out, err := utils.ZstdDecompress(data, chdr.Size)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(out)) != chdr.Size {
+			return nil, errors.New("uncompressed size mismatch")
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported compression type: %d", chdr.Type)
+}
+
+func compress(typ CompressionType, data []byte) ([]byte, error) {
+	if typ == CompressionTypeZstd {
+		return utils.ZstdCompress(data)
+	}
+
+	var buf bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestSpeed)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,37 +1,194 @@
 package linker
 
+import (
+	"debug/elf"
+	"fmt"
+	"github.com/ksco/rvld/pkg/utils"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
 type ContextArgs struct {
-	Output       string
-	Emulation    MachineType
-	LibraryPaths []string
+	Output                string
+	Emulation             MachineType
+	LibraryPaths          []string
+	Sysroot               string
+	NoStdlib              bool
+	OFormat               OutputFormat
+	GapFill               uint8
+	MapFile               string
+	PrintMap              bool
+	Cref                  bool
+	Relocatable           bool
+	EmitRelocs            bool
+	Icf                   IcfMode
+	PrintIcfSections      bool
+	SymbolOrderingFile    string
+	SectionOrderingFile   string
+	VersionScript         string
+	DynamicLists          []string
+	ExportDynamic         bool
+	Bsymbolic             bool
+	SortSection           SortSectionKind
+	ZExecStack            bool
+	ZNoExecStack          bool
+	ZRelro                bool
+	ZSeparateCode         bool
+	MaxPageSize           uint64
+	CommonPageSize        uint64
+	CompressDebugSections CompressionType
+	StripDebug            bool
+	GdbIndex              bool
+	TraceSymbols          []string
+	Wrap                  []string
+	Defsyms               []Defsym
+	Threads               int
+	BuildId               BuildId
 }
 
 type Context struct {
-	Args ContextArgs
-	Buf  []byte
+	Args    ContextArgs
+	Buf     []byte
+	FS      fs.FS
+	Stdout  io.Writer
+	MapFile io.Writer
+	Target  Target
 
 	Ehdr *OutputEhdr
 	Shdr *OutputShdr
 	Phdr *OutputPhdr
 	Got  *GotSection
 
-	TpAddr uint64
+	BuildId         *BuildIdSection
+	GdbIndex        *GdbIndexSection
+	RiscvAttributes *RiscvAttributesSection
+	ShStrtab        *StrtabSection
+	Symtab          *SymtabSection
+	Strtab          *StrtabSection
+	Dynsym          *DynsymSection
+	Dynstr          *StrtabSection
+	Hash            *HashSection
+	Versym          *VersymSection
+	Verdef          *VerdefSection
+	Dynamic         *DynamicSection
+
+	TpAddr   uint64
+	TlsBegin uint64
+
+	InternalObj   *ObjectFile
+	VersionScript *VersionScript
+	DynamicList   *VersionScript
 
 	OutputSections []*OutputSection
 
 	Chunks []Chunker
 
+	// Mu guards creation of OutputSections and MergedSections,
+	// which may happen from several parser goroutines at once.
+	Mu sync.Mutex
+
+	// MappedFiles are the input files mapped into memory; every slice
+	// of input contents points into one of them until Link returns.
+	MappedFiles [][]byte
+
+	Warnings []error
+
 	Objs           []*ObjectFile
-	SymbolMap      map[string]*Symbol
+	SymbolMap      *utils.ConcurrentMap[Symbol]
 	MergedSections []*MergedSection
+	ComdatGroups   *utils.ConcurrentMap[ComdatGroup]
+}
+
+func NewContextArgs() ContextArgs {
+	return ContextArgs{
+		Output:    "a.out",
+		Emulation: MachineTypeNone,
+		OFormat:   OutputFormatElf,
+		ZRelro:    true,
+	}
 }
 
 func NewContext() *Context {
 	return &Context{
-		Args: ContextArgs{
-			Output:    "a.out",
-			Emulation: MachineTypeNone,
-		},
-		SymbolMap: make(map[string]*Symbol),
+		Args:         NewContextArgs(),
+		Stdout:       os.Stdout,
+		SymbolMap:    utils.NewConcurrentMap[Symbol](),
+		ComdatGroups: utils.NewConcurrentMap[ComdatGroup](),
+	}
+}
+
+func (ctx *Context) Tracef(format string, a ...any) {
+	fmt.Fprintf(ctx.Stdout, format+"\n", a...)
+}
+
+func (ctx *Context) Class() elf.Class {
+	return ctx.Target.Class()
+}
+
+func (ctx *Context) Is64() bool {
+	return ctx.Class() == elf.ELFCLASS64
+}
+
+// WordSize returns XLEN in bytes.
+func (ctx *Context) WordSize() uint64 {
+	if ctx.Is64() {
+		return 8
+	}
+	return 4
+}
+
+// MaxPageSize is the largest page size the output has to run on.
+// Segments are aligned to it in both memory and the file.
+func (ctx *Context) MaxPageSize() uint64 {
+	if ctx.Args.MaxPageSize != 0 {
+		return ctx.Args.MaxPageSize
+	}
+	return ctx.Target.PageSize()
+}
+
+// CommonPageSize is the page size RELRO is padded to. It can never
+// exceed MaxPageSize.
+func (ctx *Context) CommonPageSize() uint64 {
+	size := ctx.Target.PageSize()
+	if ctx.Args.CommonPageSize != 0 {
+		size = ctx.Args.CommonPageSize
+	}
+	if size > ctx.MaxPageSize() {
+		return ctx.MaxPageSize()
+	}
+	return size
+}
+
+func (ctx *Context) Warn(err error) {
+	ctx.Mu.Lock()
+	ctx.Warnings = append(ctx.Warnings, err)
+	ctx.Mu.Unlock()
+}
+
+func (ctx *Context) ParallelFor(n int, fn func(i int)) {
+	utils.ParallelFor(ctx.Args.Threads, n, fn)
+}
+
+// UnmapFile releases an input that turned out not to be needed. Inputs
+// that were not mapped are left to the garbage collector.
+func (ctx *Context) UnmapFile(contents []byte) {
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
+
+	for i, mapped := range ctx.MappedFiles {
+		if len(mapped) > 0 && len(contents) > 0 && &mapped[0] == &contents[0] {
+			utils.Munmap(mapped)
+			ctx.MappedFiles = append(ctx.MappedFiles[:i], ctx.MappedFiles[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ctx *Context) UnmapFiles() {
+	for _, contents := range ctx.MappedFiles {
+		utils.Munmap(contents)
 	}
+	ctx.MappedFiles = nil
 }
@@ -0,0 +1,48 @@
+package linker
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Defsym is a --defsym option. The symbol is defined as Target plus
+// Addend, or as just Addend if there is no Target.
+type Defsym struct {
+	Name   string
+	Target string
+	Addend uint64
+}
+
+func ParseDefsym(arg string) (Defsym, bool) {
+	name, expr, ok := strings.Cut(arg, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || name == "" || expr == "" {
+		return Defsym{}, false
+	}
+
+	if val, ok := parseDefsymNumber(expr); ok {
+		return Defsym{Name: name, Addend: val}, true
+	}
+
+	if i := strings.LastIndexAny(expr, "+-"); i > 0 {
+		target := strings.TrimSpace(expr[:i])
+		if val, ok := parseDefsymNumber(strings.TrimSpace(expr[i+1:])); ok {
+			if expr[i] == '-' {
+				val = -val
+			}
+			return Defsym{Name: name, Target: target, Addend: val}, true
+		}
+	}
+
+	return Defsym{Name: name, Target: expr}, true
+}
+
+func parseDefsymNumber(s string) (uint64, bool) {
+	if val, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return val, true
+	}
+	if val, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return uint64(val), true
+	}
+	return 0, false
+}
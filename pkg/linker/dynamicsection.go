@@ -0,0 +1,62 @@
+package linker
+
+import "debug/elf"
+
+// DynamicSection is .dynamic, which tells a loader where to find the
+// dynamic symbol table and its versions.
+type DynamicSection struct {
+	Chunk
+}
+
+func NewDynamicSection() *DynamicSection {
+	d := &DynamicSection{Chunk: NewChunk()}
+	d.Name = ".dynamic"
+	d.Shdr.Type = uint32(elf.SHT_DYNAMIC)
+	d.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_WRITE)
+	return d
+}
+
+type DynamicEntry struct {
+	Tag elf.DynTag
+	Val uint64
+}
+
+func (d *DynamicSection) GetEntries(ctx *Context) []DynamicEntry {
+	entries := []DynamicEntry{
+		{elf.DT_HASH, ctx.Hash.Shdr.Addr},
+		{elf.DT_STRTAB, ctx.Dynstr.Shdr.Addr},
+		{elf.DT_SYMTAB, ctx.Dynsym.Shdr.Addr},
+		{elf.DT_STRSZ, ctx.Dynstr.Shdr.Size},
+		{elf.DT_SYMENT, uint64(GetSymSize(ctx.Class()))},
+	}
+
+	if ctx.Verdef != nil {
+		entries = append(entries,
+			DynamicEntry{elf.DT_VERSYM, ctx.Versym.Shdr.Addr},
+			DynamicEntry{elf.DT_VERDEF, ctx.Verdef.Shdr.Addr},
+			DynamicEntry{elf.DT_VERDEFNUM, uint64(ctx.Verdef.Shdr.Info)})
+	}
+
+	if ctx.Args.Bsymbolic {
+		entries = append(entries,
+			DynamicEntry{elf.DT_FLAGS, uint64(elf.DF_SYMBOLIC)})
+	}
+
+	return append(entries, DynamicEntry{elf.DT_NULL, 0})
+}
+
+func (d *DynamicSection) UpdateShdr(ctx *Context) {
+	d.Shdr.EntSize = 2 * ctx.WordSize()
+	d.Shdr.AddrAlign = ctx.WordSize()
+	d.Shdr.Size = uint64(len(d.GetEntries(ctx))) * d.Shdr.EntSize
+	d.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+}
+
+func (d *DynamicSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[d.Shdr.Offset:]
+	for i, ent := range d.GetEntries(ctx) {
+		buf := base[uint64(i)*d.Shdr.EntSize:]
+		WriteWord(ctx.Class(), buf, uint64(ent.Tag))
+		WriteWord(ctx.Class(), buf[ctx.WordSize():], ent.Val)
+	}
+}
@@ -0,0 +1,138 @@
+package linker
+
+import (
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+const VER_NDX_LOCAL uint16 = 0
+const VER_NDX_GLOBAL uint16 = 1
+const VERSYM_HIDDEN uint16 = 0x8000
+
+// DynsymSection is the dynamic symbol table of an executable that
+// exports symbols, with --export-dynamic or --dynamic-list. Nothing
+// loads the executable against a shared object, so every entry is a
+// definition, and there are no imports and no PLT.
+type DynsymSection struct {
+	Chunk
+	Symbols []*Symbol
+	Names   []uint32
+
+	// Versions are the .gnu.version entries of Symbols.
+	Versions []uint16
+}
+
+func NewDynsymSection() *DynsymSection {
+	d := &DynsymSection{Chunk: NewChunk()}
+	d.Name = ".dynsym"
+	d.Shdr.Type = uint32(elf.SHT_DYNSYM)
+	d.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	return d
+}
+
+// isExported reports whether sym goes into .dynsym. Hidden symbols and
+// the ones the version script makes local never do.
+func isExported(ctx *Context, sym *Symbol, vis uint8) bool {
+	if isLocalInOutput(ctx, sym, vis) {
+		return false
+	}
+	if ctx.Args.ExportDynamic {
+		return true
+	}
+	return ctx.DynamicList != nil && ctx.DynamicList.IsGlobal(getDynsymName(sym))
+}
+
+// getDynsymName strips the version from foo@VER, which is a different
+// symbol from foo in the link but is called foo in .dynsym. foo@@VER
+// is called foo already.
+func getDynsymName(sym *Symbol) string {
+	if ver, hidden := sym.GetVersion(); ver != "" && hidden {
+		return strings.TrimSuffix(sym.Name, "@"+ver)
+	}
+	return sym.Name
+}
+
+// Build collects the exported symbols and their versions. A symbol
+// named with a version gets that version, which the version script has
+// to define; any other symbol gets the node whose pattern matches it,
+// or the base version.
+func (d *DynsymSection) Build(ctx *Context) {
+	files := ctx.Objs
+	if ctx.InternalObj != nil {
+		files = append(files[:len(files):len(files)], ctx.InternalObj)
+	}
+
+	seen := make(map[*Symbol]bool)
+	for _, file := range files {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			if seen[sym] || sym.File != file || !isSymbolLive(sym, sym.ElfSym()) {
+				continue
+			}
+			seen[sym] = true
+
+			vis := mergeVisibility(sym.Visibility, sym.ElfSym().Visibility())
+			if isExported(ctx, sym, vis) {
+				d.Symbols = append(d.Symbols, sym)
+			}
+		}
+	}
+
+	script := ctx.VersionScript
+	for _, sym := range d.Symbols {
+		d.Names = append(d.Names, ctx.Dynstr.AddString(getDynsymName(sym)))
+
+		ver, hidden := sym.GetVersion()
+		if ver == "" {
+			idx := VER_NDX_GLOBAL
+			if script != nil && script.HasVersions() {
+				if node, _ := script.Match(sym.Name); node >= 0 {
+					idx = uint16(node + 2)
+				}
+			}
+			d.Versions = append(d.Versions, idx)
+			continue
+		}
+
+		var idx uint16
+		ok := false
+		if script != nil {
+			idx, ok = script.FindVersion(ver)
+		}
+		if !ok {
+			fail(&LinkError{File: sym.File.File.DisplayName(), Symbol: sym.Name,
+				Err: fmt.Errorf("symbol has undefined version %s", ver)})
+		}
+		if hidden {
+			idx |= VERSYM_HIDDEN
+		}
+		d.Versions = append(d.Versions, idx)
+	}
+
+	d.Shdr.Size = uint64((len(d.Symbols) + 1) * GetSymSize(ctx.Class()))
+}
+
+func (d *DynsymSection) UpdateShdr(ctx *Context) {
+	d.Shdr.EntSize = uint64(GetSymSize(ctx.Class()))
+	d.Shdr.AddrAlign = ctx.WordSize()
+	d.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+	d.Shdr.Info = 1
+}
+
+func (d *DynsymSection) CopyBuf(ctx *Context) {
+	syms := make([]Sym, len(d.Symbols)+1)
+	for i, sym := range d.Symbols {
+		esym := *sym.ElfSym()
+		esym.Name = d.Names[i]
+		esym.Other = esym.Other&^3 |
+			mergeVisibility(sym.Visibility, esym.Visibility())
+		esym.Shndx = getOutputShndx(sym, sym.ElfSym())
+		if !esym.IsUndef() && !esym.IsCommon() {
+			esym.Val = sym.GetAddr()
+		}
+		syms[i+1] = esym
+	}
+
+	WriteSyms(ctx.Class(), ctx.Buf[d.Shdr.Offset:], syms)
+}
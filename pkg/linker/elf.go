@@ -3,16 +3,31 @@ package linker
 import (
 	"bytes"
 	"debug/elf"
-	"github.com/ksco/rvld/pkg/utils"
 	"strconv"
 	"strings"
 	"unsafe"
 )
 
-const PageSize = 4096
-
-const IMAGE_BASE uint64 = 0x200000
 const EF_RISCV_RVC uint32 = 1
+const GRP_COMDAT uint32 = 1
+const NT_GNU_BUILD_ID uint32 = 3
+
+const (
+	EF_RISCV_FLOAT_ABI        uint32 = 0x6
+	EF_RISCV_FLOAT_ABI_SOFT   uint32 = 0x0
+	EF_RISCV_FLOAT_ABI_SINGLE uint32 = 0x2
+	EF_RISCV_FLOAT_ABI_DOUBLE uint32 = 0x4
+	EF_RISCV_FLOAT_ABI_QUAD   uint32 = 0x6
+	EF_RISCV_RVE              uint32 = 0x8
+	EF_RISCV_TSO              uint32 = 0x10
+)
+
+const SHT_RISCV_ATTRIBUTES uint32 = 0x70000003
+const PT_RISCV_ATTRIBUTES uint32 = 0x70000003
+const SHT_LLVM_ADDRSIG uint32 = 0x6fff4c03
+const ELFCOMPRESS_ZSTD uint32 = 2
+const R_RISCV_SET_ULEB128 uint32 = 60
+const R_RISCV_SUB_ULEB128 uint32 = 61
 
 const EhdrSize = int(unsafe.Sizeof(Ehdr{}))
 const ShdrSize = int(unsafe.Sizeof(Shdr{}))
@@ -20,6 +35,16 @@ const PhdrSize = int(unsafe.Sizeof(Phdr{}))
 const SymSize = int(unsafe.Sizeof(Sym{}))
 const ArHdrSize = int(unsafe.Sizeof(ArHdr{}))
 const RelaSize = int(unsafe.Sizeof(Rela{}))
+const ChdrSize = int(unsafe.Sizeof(Chdr{}))
+const VerdefSize = int(unsafe.Sizeof(Verdef{}))
+const VerdauxSize = int(unsafe.Sizeof(Verdaux{}))
+
+const Ehdr32Size = int(unsafe.Sizeof(Ehdr32{}))
+const Shdr32Size = int(unsafe.Sizeof(Shdr32{}))
+const Phdr32Size = int(unsafe.Sizeof(Phdr32{}))
+const Sym32Size = int(unsafe.Sizeof(Sym32{}))
+const Rela32Size = int(unsafe.Sizeof(Rela32{}))
+const Chdr32Size = int(unsafe.Sizeof(Chdr32{}))
 
 type Ehdr struct {
 	Ident     [16]uint8
@@ -71,6 +96,18 @@ type Sym struct {
 	Size  uint64
 }
 
+func (s *Sym) Type() uint8 {
+	return s.Info & 0xf
+}
+
+func (s *Sym) Binding() uint8 {
+	return s.Info >> 4
+}
+
+func (s *Sym) Visibility() uint8 {
+	return s.Other & 3
+}
+
 func (s *Sym) IsAbs() bool {
 	return s.Shndx == uint16(elf.SHN_ABS)
 }
@@ -90,6 +127,92 @@ type Rela struct {
 	Addend int64
 }
 
+type Chdr struct {
+	Type      uint32
+	Reserved  uint32
+	Size      uint64
+	AddrAlign uint64
+}
+
+// Verdef and Verdaux make up .gnu.version_d. They are the same in
+// ELF32 and ELF64.
+type Verdef struct {
+	Version uint16
+	Flags   uint16
+	Ndx     uint16
+	Cnt     uint16
+	Hash    uint32
+	Aux     uint32
+	Next    uint32
+}
+
+type Verdaux struct {
+	Name uint32
+	Next uint32
+}
+
+type Ehdr32 struct {
+	Ident     [16]uint8
+	Type      uint16
+	Machine   uint16
+	Version   uint32
+	Entry     uint32
+	PhOff     uint32
+	ShOff     uint32
+	Flags     uint32
+	EhSize    uint16
+	PhEntSize uint16
+	PhNum     uint16
+	ShEntSize uint16
+	ShNum     uint16
+	ShStrndx  uint16
+}
+
+type Shdr32 struct {
+	Name      uint32
+	Type      uint32
+	Flags     uint32
+	Addr      uint32
+	Offset    uint32
+	Size      uint32
+	Link      uint32
+	Info      uint32
+	AddrAlign uint32
+	EntSize   uint32
+}
+
+type Phdr32 struct {
+	Type     uint32
+	Offset   uint32
+	VAddr    uint32
+	PAddr    uint32
+	FileSize uint32
+	MemSize  uint32
+	Flags    uint32
+	Align    uint32
+}
+
+type Sym32 struct {
+	Name  uint32
+	Val   uint32
+	Size  uint32
+	Info  uint8
+	Other uint8
+	Shndx uint16
+}
+
+type Rela32 struct {
+	Offset uint32
+	Info   uint32
+	Addend int32
+}
+
+type Chdr32 struct {
+	Type      uint32
+	Size      uint32
+	AddrAlign uint32
+}
+
 type ArHdr struct {
 	Name [16]byte
 	Date [12]byte
@@ -114,7 +237,7 @@ func (a *ArHdr) IsSymtab() bool {
 
 func (a *ArHdr) GetSize() int {
 	size, err := strconv.Atoi(strings.TrimSpace(string(a.Size[:])))
-	utils.MustNo(err)
+	mustNo(err)
 	return size
 }
 
@@ -122,14 +245,14 @@ func (a *ArHdr) ReadName(strTab []byte) string {
 	// Long filename
 	if a.HasPrefix("/") {
 		start, err := strconv.Atoi(strings.TrimSpace(string(a.Name[1:])))
-		utils.MustNo(err)
+		mustNo(err)
 		end := start + bytes.Index(strTab[start:], []byte("/\n"))
 		return string(strTab[start:end])
 	}
 
 	// Short filename
 	end := bytes.Index(a.Name[:], []byte("/"))
-	utils.Assert(end != -1)
+	assert(end != -1)
 	return string(a.Name[:end])
 }
 
@@ -0,0 +1,23 @@
+package linker
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// utils.Read and friends copy structures in place on little-endian
+// hosts, which only agrees with encoding/binary if there's no padding.
+func TestElfStructsHaveNoPadding(t *testing.T) {
+	for _, val := range []any{
+		Ehdr{}, Shdr{}, Phdr{}, Sym{}, Rela{}, Chdr{},
+		Ehdr32{}, Shdr32{}, Phdr32{}, Sym32{}, Rela32{}, Chdr32{},
+		Verdef{}, Verdaux{}, ArHdr{},
+	} {
+		size := reflect.TypeOf(val).Size()
+		if binary.Size(val) != int(size) {
+			t.Errorf("%T is %d bytes in memory but %d encoded",
+				val, size, binary.Size(val))
+		}
+	}
+}
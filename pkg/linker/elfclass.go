@@ -0,0 +1,287 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+)
+
+// The linker works on the ELF64 structures internally. ELF32 inputs
+// are widened when they are read and the output is narrowed again
+// when it is written, so only this file has to know about the class.
+
+func GetElfClass(contents []byte) elf.Class {
+	if len(contents) <= elf.EI_CLASS {
+		return elf.ELFCLASSNONE
+	}
+	return elf.Class(contents[elf.EI_CLASS])
+}
+
+func GetEhdrSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Ehdr32Size
+	}
+	return EhdrSize
+}
+
+func GetShdrSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Shdr32Size
+	}
+	return ShdrSize
+}
+
+func GetPhdrSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Phdr32Size
+	}
+	return PhdrSize
+}
+
+func GetSymSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Sym32Size
+	}
+	return SymSize
+}
+
+func GetRelaSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Rela32Size
+	}
+	return RelaSize
+}
+
+func GetChdrSize(class elf.Class) int {
+	if class == elf.ELFCLASS32 {
+		return Chdr32Size
+	}
+	return ChdrSize
+}
+
+func ReadEhdr(class elf.Class, data []byte) Ehdr {
+	if class != elf.ELFCLASS32 {
+		return utils.Read[Ehdr](data)
+	}
+
+	e := utils.Read[Ehdr32](data)
+	return Ehdr{
+		Ident:     e.Ident,
+		Type:      e.Type,
+		Machine:   e.Machine,
+		Version:   e.Version,
+		Entry:     uint64(e.Entry),
+		PhOff:     uint64(e.PhOff),
+		ShOff:     uint64(e.ShOff),
+		Flags:     e.Flags,
+		EhSize:    e.EhSize,
+		PhEntSize: e.PhEntSize,
+		PhNum:     e.PhNum,
+		ShEntSize: e.ShEntSize,
+		ShNum:     e.ShNum,
+		ShStrndx:  e.ShStrndx,
+	}
+}
+
+func ReadShdrs(class elf.Class, data []byte) []Shdr {
+	if class != elf.ELFCLASS32 {
+		return utils.ReadSlice[Shdr](data, ShdrSize)
+	}
+
+	src := utils.ReadSlice[Shdr32](data, Shdr32Size)
+	shdrs := make([]Shdr, len(src))
+	for i, s := range src {
+		shdrs[i] = Shdr{
+			Name:      s.Name,
+			Type:      s.Type,
+			Flags:     uint64(s.Flags),
+			Addr:      uint64(s.Addr),
+			Offset:    uint64(s.Offset),
+			Size:      uint64(s.Size),
+			Link:      s.Link,
+			Info:      s.Info,
+			AddrAlign: uint64(s.AddrAlign),
+			EntSize:   uint64(s.EntSize),
+		}
+	}
+	return shdrs
+}
+
+func ReadSyms(class elf.Class, data []byte) []Sym {
+	if class != elf.ELFCLASS32 {
+		return utils.ReadSlice[Sym](data, SymSize)
+	}
+
+	src := utils.ReadSlice[Sym32](data, Sym32Size)
+	syms := make([]Sym, len(src))
+	for i, s := range src {
+		syms[i] = Sym{
+			Name:  s.Name,
+			Info:  s.Info,
+			Other: s.Other,
+			Shndx: s.Shndx,
+			Val:   uint64(s.Val),
+			Size:  uint64(s.Size),
+		}
+	}
+	return syms
+}
+
+func ReadRelas(class elf.Class, data []byte) []Rela {
+	if class != elf.ELFCLASS32 {
+		return utils.ReadSlice[Rela](data, RelaSize)
+	}
+
+	src := utils.ReadSlice[Rela32](data, Rela32Size)
+	rels := make([]Rela, len(src))
+	for i, r := range src {
+		rels[i] = Rela{
+			Offset: uint64(r.Offset),
+			Type:   r.Info & 0xff,
+			Sym:    r.Info >> 8,
+			Addend: int64(r.Addend),
+		}
+	}
+	return rels
+}
+
+func ReadChdr(class elf.Class, data []byte) Chdr {
+	if class != elf.ELFCLASS32 {
+		return utils.Read[Chdr](data)
+	}
+
+	c := utils.Read[Chdr32](data)
+	return Chdr{
+		Type:      c.Type,
+		Size:      uint64(c.Size),
+		AddrAlign: uint64(c.AddrAlign),
+	}
+}
+
+func WriteEhdr(class elf.Class, buf []byte, e Ehdr) {
+	if class != elf.ELFCLASS32 {
+		utils.Write[Ehdr](buf, e)
+		return
+	}
+
+	utils.Write[Ehdr32](buf, Ehdr32{
+		Ident:     e.Ident,
+		Type:      e.Type,
+		Machine:   e.Machine,
+		Version:   e.Version,
+		Entry:     uint32(e.Entry),
+		PhOff:     uint32(e.PhOff),
+		ShOff:     uint32(e.ShOff),
+		Flags:     e.Flags,
+		EhSize:    e.EhSize,
+		PhEntSize: e.PhEntSize,
+		PhNum:     e.PhNum,
+		ShEntSize: e.ShEntSize,
+		ShNum:     e.ShNum,
+		ShStrndx:  e.ShStrndx,
+	})
+}
+
+func WriteShdrs(class elf.Class, buf []byte, shdrs []Shdr) {
+	if class != elf.ELFCLASS32 {
+		utils.WriteSlice(buf, shdrs)
+		return
+	}
+
+	dst := make([]Shdr32, len(shdrs))
+	for i, s := range shdrs {
+		dst[i] = Shdr32{
+			Name:      s.Name,
+			Type:      s.Type,
+			Flags:     uint32(s.Flags),
+			Addr:      uint32(s.Addr),
+			Offset:    uint32(s.Offset),
+			Size:      uint32(s.Size),
+			Link:      s.Link,
+			Info:      s.Info,
+			AddrAlign: uint32(s.AddrAlign),
+			EntSize:   uint32(s.EntSize),
+		}
+	}
+	utils.WriteSlice(buf, dst)
+}
+
+func WritePhdrs(class elf.Class, buf []byte, phdrs []Phdr) {
+	if class != elf.ELFCLASS32 {
+		utils.WriteSlice(buf, phdrs)
+		return
+	}
+
+	dst := make([]Phdr32, len(phdrs))
+	for i, p := range phdrs {
+		dst[i] = Phdr32{
+			Type:     p.Type,
+			Offset:   uint32(p.Offset),
+			VAddr:    uint32(p.VAddr),
+			PAddr:    uint32(p.PAddr),
+			FileSize: uint32(p.FileSize),
+			MemSize:  uint32(p.MemSize),
+			Flags:    p.Flags,
+			Align:    uint32(p.Align),
+		}
+	}
+	utils.WriteSlice(buf, dst)
+}
+
+func WriteSyms(class elf.Class, buf []byte, syms []Sym) {
+	if class != elf.ELFCLASS32 {
+		utils.WriteSlice(buf, syms)
+		return
+	}
+
+	dst := make([]Sym32, len(syms))
+	for i, s := range syms {
+		dst[i] = Sym32{
+			Name:  s.Name,
+			Val:   uint32(s.Val),
+			Size:  uint32(s.Size),
+			Info:  s.Info,
+			Other: s.Other,
+			Shndx: s.Shndx,
+		}
+	}
+	utils.WriteSlice(buf, dst)
+}
+
+func WriteRelas(class elf.Class, buf []byte, rels []Rela) {
+	if class != elf.ELFCLASS32 {
+		utils.WriteSlice(buf, rels)
+		return
+	}
+
+	dst := make([]Rela32, len(rels))
+	for i, r := range rels {
+		dst[i] = Rela32{
+			Offset: uint32(r.Offset),
+			Info:   r.Sym<<8 | r.Type&0xff,
+			Addend: int32(r.Addend),
+		}
+	}
+	utils.WriteSlice(buf, dst)
+}
+
+func WriteChdr(class elf.Class, buf []byte, c Chdr) {
+	if class != elf.ELFCLASS32 {
+		utils.Write(buf, c)
+		return
+	}
+
+	utils.Write(buf, Chdr32{
+		Type:      c.Type,
+		Size:      uint32(c.Size),
+		AddrAlign: uint32(c.AddrAlign),
+	})
+}
+
+// WriteWord stores an XLEN-sized value such as a GOT entry.
+func WriteWord(class elf.Class, buf []byte, val uint64) {
+	if class == elf.ELFCLASS32 {
+		utils.Write[uint32](buf, uint32(val))
+	} else {
+		utils.Write[uint64](buf, val)
+	}
+}
@@ -1,8 +1,15 @@
 package linker
 
 import (
+	"errors"
+	"fmt"
 	"github.com/ksco/rvld/pkg/utils"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 type File struct {
@@ -11,17 +18,66 @@ type File struct {
 	Parent   *File
 }
 
-func MustNewFile(filename string) *File {
-	contents, err := os.ReadFile(filename)
-	utils.MustNo(err)
+func readFile(ctx *Context, filename string) ([]byte, error) {
+	if ctx.FS != nil {
+		return fs.ReadFile(ctx.FS, filename)
+	}
+	if !utils.CanMmap {
+		return os.ReadFile(filename)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 || !info.Mode().IsRegular() {
+		return io.ReadAll(file)
+	}
+
+	contents, err := utils.Mmap(file, int(info.Size()), false)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Mu.Lock()
+	ctx.MappedFiles = append(ctx.MappedFiles, contents)
+	ctx.Mu.Unlock()
+	return contents, nil
+}
+
+func MustNewFile(ctx *Context, filename string) *File {
+	contents, err := readFile(ctx, filename)
+	if err != nil {
+		fail(&LinkError{File: filename, Err: err})
+	}
+
 	return &File{
 		Name:     filename,
 		Contents: contents,
 	}
 }
 
-func OpenLibrary(filepath string) *File {
-	contents, err := os.ReadFile(filepath)
+func MustNewFileFromReader(name string, r io.ReaderAt, size int64) *File {
+	contents := make([]byte, size)
+	if _, err := r.ReadAt(contents, 0); err != nil && !errors.Is(err, io.EOF) {
+		fail(&LinkError{File: name, Err: err})
+	}
+
+	return &File{
+		Name:     name,
+		Contents: contents,
+	}
+}
+
+func OpenLibrary(ctx *Context, filepath string) *File {
+	contents, err := readFile(ctx, filepath)
 	if err != nil {
 		return nil
 	}
@@ -32,14 +88,121 @@ func OpenLibrary(filepath string) *File {
 	}
 }
 
-func FindLibrary(ctx *Context, name string) *File {
-	for _, dir := range ctx.Args.LibraryPaths {
-		stem := dir + "/lib" + name + ".a"
-		if f := OpenLibrary(stem); f != nil {
+// FindLibrary searches the library directories for -lname, or for a
+// file called exactly name after -l:. Within each directory a shared
+// library comes before an archive, unless static is set by -Bstatic.
+// Since rvld can't link against shared objects, an archive next to a
+// real one is used instead, with a warning; a .so that is a linker
+// script still wins.
+func FindLibrary(ctx *Context, name string, static bool) *File {
+	filenames := []string{"lib" + name + ".so", "lib" + name + ".a"}
+	if static {
+		filenames = filenames[1:]
+	}
+	if filename, ok := utils.RemovePrefix(name, ":"); ok {
+		filenames = []string{filename}
+	}
+
+	tried := make([]string, 0)
+	for _, dir := range getLibraryPaths(ctx) {
+		var shared *File
+		for _, filename := range filenames {
+			path := filepath.Join(dir, filename)
+			f := OpenLibrary(ctx, path)
+			if f == nil {
+				tried = append(tried, path)
+				continue
+			}
+			if len(filenames) == 2 && shared == nil &&
+				GetFileType(f.Contents) == FileTypeShared {
+				shared = f
+				continue
+			}
+			if shared != nil {
+				ctx.Warn(&LinkError{File: "-l" + name, Err: fmt.Errorf(
+					"using %s instead of %s: shared libraries are not supported",
+					f.Name, shared.Name)})
+				ctx.UnmapFile(shared.Contents)
+			}
 			return f
 		}
+		if shared != nil {
+			return shared
+		}
 	}
 
-	utils.Fatal("library not found")
+	msg := "library not found"
+	if len(tried) > 0 {
+		msg += "; searched:\n\t" + strings.Join(tried, "\n\t")
+	}
+	fail(&LinkError{File: "-l" + name, Err: errors.New(msg)})
 	return nil
 }
+
+// getLibraryPaths returns the -L directories followed by the default
+// ones, all within the sysroot where that applies.
+func getLibraryPaths(ctx *Context) []string {
+	paths := make([]string, 0)
+	for _, dir := range ctx.Args.LibraryPaths {
+		paths = append(paths, expandSysroot(ctx, dir))
+	}
+
+	if !ctx.Args.NoStdlib {
+		for _, dir := range defaultLibraryPaths(ctx) {
+			paths = append(paths, filepath.Join(ctx.Args.Sysroot, dir))
+		}
+	}
+	return paths
+}
+
+// expandSysroot rewrites a path starting with "=" or "$SYSROOT" to be
+// relative to the sysroot. Without --sysroot the prefix is dropped.
+func expandSysroot(ctx *Context, path string) string {
+	for _, prefix := range []string{"=", "$SYSROOT"} {
+		if rest, ok := utils.RemovePrefix(path, prefix); ok {
+			return filepath.Join(ctx.Args.Sysroot, rest)
+		}
+	}
+	return path
+}
+
+// defaultLibraryPaths are the directories GNU ld searches on Debian
+// style systems, where libraries of each target live in a directory
+// named after its triple. Without a sysroot, the plain /lib and /usr/lib
+// hold libraries of the host, so they are only searched when linking
+// for the host.
+func defaultLibraryPaths(ctx *Context) []string {
+	m := ctx.Args.Emulation
+	dirs := []string{"/usr/local/lib", "/lib", "/usr/lib"}
+	if m == MachineTypeNone {
+		return dirs
+	}
+
+	triple := MachineTypeStringer{m}.String() + "-linux-gnu"
+	paths := []string{
+		"/usr/local/lib/" + triple,
+		"/lib/" + triple,
+		"/usr/lib/" + triple,
+	}
+	if ctx.Args.Sysroot != "" || m == getHostMachineType() {
+		paths = append(paths, dirs...)
+	}
+	return append(paths, "/usr/"+triple+"/lib")
+}
+
+func getHostMachineType() MachineType {
+	switch runtime.GOARCH {
+	case "amd64":
+		return MachineTypeX86_64
+	case "riscv64":
+		return MachineTypeRISCV64
+	}
+	return MachineTypeNone
+}
+
+func (f *File) DisplayName() string {
+	if f.Parent != nil {
+		return f.Parent.Name + "(" + f.Name + ")"
+	}
+	return f.Name
+}
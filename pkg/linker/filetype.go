@@ -3,6 +3,7 @@ package linker
 import (
 	"bytes"
 	"debug/elf"
+	"errors"
 	"github.com/ksco/rvld/pkg/utils"
 )
 
@@ -13,6 +14,8 @@ const (
 	FileTypeEmpty   FileType = iota
 	FileTypeObject  FileType = iota
 	FileTypeArchive FileType = iota
+	FileTypeShared  FileType = iota
+	FileTypeText    FileType = iota
 )
 
 func GetFileType(contents []byte) FileType {
@@ -25,6 +28,8 @@ func GetFileType(contents []byte) FileType {
 		switch et {
 		case elf.ET_REL:
 			return FileTypeObject
+		case elf.ET_DYN:
+			return FileTypeShared
 		}
 		return FileTypeUnknown
 	}
@@ -33,12 +38,29 @@ func GetFileType(contents []byte) FileType {
 		return FileTypeArchive
 	}
 
+	if isText(contents) {
+		return FileTypeText
+	}
+
 	return FileTypeUnknown
 }
 
+// isText reports whether contents look like a linker script, which is
+// what any input that isn't ELF or an archive is taken to be.
+func isText(contents []byte) bool {
+	for _, c := range contents {
+		if (c < ' ' || c > '~') && c != '\t' && c != '\n' && c != '\r' &&
+			c != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
 func CheckFileCompatibility(ctx *Context, file *File) {
 	mt := GetMachineTypeFromContents(file.Contents)
 	if mt != ctx.Args.Emulation {
-		utils.Fatal("incompatible file type")
+		fail(&LinkError{File: file.DisplayName(),
+			Err: errors.New("incompatible file type")})
 	}
 }
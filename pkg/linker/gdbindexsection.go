@@ -0,0 +1,351 @@
+package linker
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"github.com/ksco/rvld/pkg/utils"
+	"math/bits"
+)
+
+const gdbIndexVersion = 7
+
+// GdbIndexSection is .gdb_index, which lets gdb find the compilation
+// unit covering an address or defining a name without reading all of
+// .debug_info at startup. It is built from the relocated debug
+// sections once addresses are final. Names come from
+// .debug_gnu_pubnames and .debug_gnu_pubtypes, as with other linkers,
+// so inputs need to be compiled with -ggnu-pubnames.
+type GdbIndexSection struct {
+	Chunk
+	Contents []byte
+}
+
+type gdbIndexCu struct {
+	Offset uint64
+	Length uint64
+	Ranges [][2]uint64
+}
+
+type gdbIndexSymbol struct {
+	Name  string
+	Attrs []uint32
+}
+
+func NewGdbIndexSection() *GdbIndexSection {
+	g := &GdbIndexSection{Chunk: NewChunk()}
+	g.Name = ".gdb_index"
+	g.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	g.Shdr.AddrAlign = 4
+	return g
+}
+
+func (g *GdbIndexSection) Build(ctx *Context) {
+	writers := make([]ChunkWriter, 0)
+	for _, chunk := range ctx.Chunks {
+		if w, ok := chunk.(ChunkWriter); ok &&
+			chunk.GetShdr().Flags&uint64(elf.SHF_ALLOC) == 0 {
+			writers = append(writers, w)
+		}
+	}
+
+	bufs := make([][]byte, len(writers))
+	ctx.ParallelFor(len(writers), func(i int) {
+		bufs[i] = make([]byte, writers[i].GetShdr().Size)
+		writers[i].WriteTo(ctx, bufs[i])
+	})
+
+	sections := make(map[string][]byte)
+	for i, w := range writers {
+		sections[w.GetName()] = bufs[i]
+	}
+
+	cus, err := readGdbIndexCus(sections)
+	if err != nil {
+		fail(&LinkError{Section: ".debug_info", Err: err})
+	}
+
+	symbols, err := readGdbIndexSymbols(sections, cus)
+	if err != nil {
+		fail(&LinkError{Section: ".debug_gnu_pubnames", Err: err})
+	}
+
+	g.Contents = encodeGdbIndex(cus, symbols)
+	g.Shdr.Size = uint64(len(g.Contents))
+}
+
+func (g *GdbIndexSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[g.Shdr.Offset:], g.Contents)
+}
+
+// readGdbIndexCus lists the compile units in .debug_info along with the
+// address ranges they cover. debug/dwarf doesn't report where a unit
+// starts or how long it is, so the unit headers are walked here and
+// matched with the units the reader returns, which come in the same
+// order.
+func readGdbIndexCus(sections map[string][]byte) ([]*gdbIndexCu, error) {
+	info := sections[".debug_info"]
+	if len(info) == 0 {
+		return nil, nil
+	}
+
+	d, err := dwarf.New(sections[".debug_abbrev"], nil, nil, info,
+		sections[".debug_line"], nil, sections[".debug_ranges"],
+		sections[".debug_str"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{".debug_addr", ".debug_line_str",
+		".debug_rnglists", ".debug_str_offsets"} {
+		if data, ok := sections[name]; ok {
+			if err := d.AddSection(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cus := make([]*gdbIndexCu, 0)
+	r := d.Reader()
+	for offset := uint64(0); offset < uint64(len(info)); {
+		length, isCu, err := readUnitHeader(info[offset:])
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, errors.New("unit has no entries")
+		}
+		r.SkipChildren()
+
+		if isCu {
+			cu := &gdbIndexCu{Offset: offset, Length: length}
+			ranges, err := d.Ranges(e)
+			if err != nil {
+				return nil, err
+			}
+			for _, rng := range ranges {
+				// Code discarded from the output is left at address
+				// zero or at a tombstone near the top of the space.
+				if rng[0] != 0 && rng[0] < rng[1] &&
+					rng[0] < uint64(0xffff_ffff_ffff_fffe) {
+					cu.Ranges = append(cu.Ranges, rng)
+				}
+			}
+			cus = append(cus, cu)
+		}
+		offset += length
+	}
+	return cus, nil
+}
+
+// readUnitHeader returns the total size of the unit at the start of data
+// and whether it is a compile unit, as opposed to a type unit.
+func readUnitHeader(data []byte) (uint64, bool, error) {
+	if len(data) < 4 {
+		return 0, false, errors.New("truncated unit header")
+	}
+
+	length := uint64(utils.Read[uint32](data))
+	headerSize := uint64(4)
+	if length == 0xffff_ffff {
+		if len(data) < 12 {
+			return 0, false, errors.New("truncated unit header")
+		}
+		length = utils.Read[uint64](data[4:])
+		headerSize = 12
+	}
+
+	if length+headerSize > uint64(len(data)) || length < 3 {
+		return 0, false, errors.New("unit extends past the end of section")
+	}
+
+	version := utils.Read[uint16](data[headerSize:])
+	isCu := true
+	if version >= 5 {
+		typ := data[headerSize+2]
+		isCu = typ == 0x01 || typ == 0x03 // DW_UT_compile, DW_UT_partial
+	}
+	return length + headerSize, isCu, nil
+}
+
+// readGdbIndexSymbols collects the public names and types of all
+// compile units. The flag byte of each entry has the same layout as
+// the attributes gdb wants in the top byte of a CU vector entry.
+func readGdbIndexSymbols(sections map[string][]byte,
+	cus []*gdbIndexCu) ([]*gdbIndexSymbol, error) {
+	cuIdx := make(map[uint64]int)
+	for i, cu := range cus {
+		cuIdx[cu.Offset] = i
+	}
+
+	symbols := make([]*gdbIndexSymbol, 0)
+	byName := make(map[string]*gdbIndexSymbol)
+	seen := make(map[*gdbIndexSymbol]map[uint32]bool)
+
+	for _, name := range []string{".debug_gnu_pubnames", ".debug_gnu_pubtypes"} {
+		data := sections[name]
+		for len(data) > 0 {
+			if len(data) < 4 {
+				return nil, errors.New("truncated set header")
+			}
+
+			length := uint64(utils.Read[uint32](data))
+			data = data[4:]
+			offsetSize := 4
+			if length == 0xffff_ffff {
+				if len(data) < 8 {
+					return nil, errors.New("truncated set header")
+				}
+				length = utils.Read[uint64](data)
+				data = data[8:]
+				offsetSize = 8
+			}
+			if length > uint64(len(data)) ||
+				length < uint64(2+offsetSize*2) {
+				return nil, errors.New("set extends past the end of section")
+			}
+
+			set := data[2:length]
+			data = data[length:]
+
+			readOffset := func() uint64 {
+				if offsetSize == 8 {
+					val := utils.Read[uint64](set)
+					set = set[8:]
+					return val
+				}
+				val := uint64(utils.Read[uint32](set))
+				set = set[4:]
+				return val
+			}
+
+			idx, ok := cuIdx[readOffset()]
+			if !ok {
+				return nil, errors.New("set refers to an unknown unit")
+			}
+			readOffset()
+
+			for len(set) >= offsetSize && readOffset() != 0 {
+				if len(set) == 0 {
+					return nil, errors.New("truncated entry")
+				}
+				end := bytes.IndexByte(set[1:], 0)
+				if end == -1 {
+					return nil, errors.New("name is not null terminated")
+				}
+
+				attrs := uint32(idx) | uint32(set[0])<<24
+				key := string(set[1 : end+1])
+				set = set[end+2:]
+
+				sym, ok := byName[key]
+				if !ok {
+					sym = &gdbIndexSymbol{Name: key}
+					byName[key] = sym
+					seen[sym] = make(map[uint32]bool)
+					symbols = append(symbols, sym)
+				}
+				if !seen[sym][attrs] {
+					seen[sym][attrs] = true
+					sym.Attrs = append(sym.Attrs, attrs)
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+func gdbIndexHash(name string) uint32 {
+	h := uint32(0)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		h = h*67 + uint32(c) - 113
+	}
+	return h
+}
+
+func encodeGdbIndex(cus []*gdbIndexCu, symbols []*gdbIndexSymbol) []byte {
+	// The constant pool holds every CU vector, followed by every name.
+	pool := make([]byte, 0)
+	vecOffsets := make([]uint32, len(symbols))
+	for i, sym := range symbols {
+		vecOffsets[i] = uint32(len(pool))
+		pool = binary.LittleEndian.AppendUint32(pool, uint32(len(sym.Attrs)))
+		for _, attrs := range sym.Attrs {
+			pool = binary.LittleEndian.AppendUint32(pool, attrs)
+		}
+	}
+	nameOffsets := make([]uint32, len(symbols))
+	for i, sym := range symbols {
+		nameOffsets[i] = uint32(len(pool))
+		pool = append(pool, sym.Name...)
+		pool = append(pool, 0)
+	}
+
+	// gdb probes the table until it finds an empty slot, so there must
+	// always be one.
+	numSlots := uint32(1) << bits.Len32(uint32(len(symbols)*4/3))
+	mask := numSlots - 1
+	slots := make([][2]uint32, numSlots)
+	used := make([]bool, numSlots)
+	for i, sym := range symbols {
+		h := gdbIndexHash(sym.Name)
+		idx := h & mask
+		step := ((h * 17) & mask) | 1
+		for used[idx] {
+			idx = (idx + step) & mask
+		}
+		used[idx] = true
+		slots[idx] = [2]uint32{nameOffsets[i], vecOffsets[i]}
+	}
+
+	numRanges := 0
+	for _, cu := range cus {
+		numRanges += len(cu.Ranges)
+	}
+
+	cuListOffset := uint32(24)
+	typesOffset := cuListOffset + uint32(len(cus))*16
+	addrOffset := typesOffset
+	symtabOffset := addrOffset + uint32(numRanges)*20
+	poolOffset := symtabOffset + numSlots*8
+
+	le := binary.LittleEndian
+	out := make([]byte, 0, int(poolOffset)+len(pool))
+	out = le.AppendUint32(out, gdbIndexVersion)
+	out = le.AppendUint32(out, cuListOffset)
+	out = le.AppendUint32(out, typesOffset)
+	out = le.AppendUint32(out, addrOffset)
+	out = le.AppendUint32(out, symtabOffset)
+	out = le.AppendUint32(out, poolOffset)
+
+	for _, cu := range cus {
+		out = le.AppendUint64(out, cu.Offset)
+		out = le.AppendUint64(out, cu.Length)
+	}
+
+	for i, cu := range cus {
+		for _, rng := range cu.Ranges {
+			out = le.AppendUint64(out, rng[0])
+			out = le.AppendUint64(out, rng[1])
+			out = le.AppendUint32(out, uint32(i))
+		}
+	}
+
+	for _, slot := range slots {
+		out = le.AppendUint32(out, slot[0])
+		out = le.AppendUint32(out, slot[1])
+	}
+
+	return append(out, pool...)
+}
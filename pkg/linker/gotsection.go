@@ -1,12 +1,10 @@
 package linker
 
-import (
-	"debug/elf"
-	"github.com/ksco/rvld/pkg/utils"
-)
+import "debug/elf"
 
 type GotSection struct {
 	Chunk
+	GotSyms   []*Symbol
 	GotTpSyms []*Symbol
 }
 
@@ -19,9 +17,19 @@ func NewGotSection() *GotSection {
 	return g
 }
 
-func (g *GotSection) AddGotTpSymbol(sym *Symbol) {
-	sym.GotTpIdx = int32(g.Shdr.Size / 8)
-	g.Shdr.Size += 8
+func (g *GotSection) UpdateShdr(ctx *Context) {
+	g.Shdr.AddrAlign = ctx.WordSize()
+}
+
+func (g *GotSection) AddGotSymbol(ctx *Context, sym *Symbol) {
+	sym.GotIdx = int32(g.Shdr.Size / ctx.WordSize())
+	g.Shdr.Size += ctx.WordSize()
+	g.GotSyms = append(g.GotSyms, sym)
+}
+
+func (g *GotSection) AddGotTpSymbol(ctx *Context, sym *Symbol) {
+	sym.GotTpIdx = int32(g.Shdr.Size / ctx.WordSize())
+	g.Shdr.Size += ctx.WordSize()
 	g.GotTpSyms = append(g.GotTpSyms, sym)
 }
 
@@ -32,6 +40,11 @@ type GotEntry struct {
 
 func (g *GotSection) GetEntries(ctx *Context) []GotEntry {
 	entries := make([]GotEntry, 0)
+	for _, sym := range g.GotSyms {
+		entries = append(entries,
+			GotEntry{Idx: int64(sym.GotIdx), Val: sym.GetAddr()})
+	}
+
 	for _, sym := range g.GotTpSyms {
 		idx := sym.GotTpIdx
 		entries = append(entries,
@@ -44,6 +57,6 @@ func (g *GotSection) GetEntries(ctx *Context) []GotEntry {
 func (g *GotSection) CopyBuf(ctx *Context) {
 	base := ctx.Buf[g.Shdr.Offset:]
 	for _, ent := range g.GetEntries(ctx) {
-		utils.Write[uint64](base[ent.Idx*8:], ent.Val)
+		WriteWord(ctx.Class(), base[uint64(ent.Idx)*ctx.WordSize():], ent.Val)
 	}
 }
@@ -0,0 +1,59 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+)
+
+// HashSection is the SysV .hash table of .dynsym, which a loader needs to
+// look symbols up. Each symbol gets a bucket of its own.
+type HashSection struct {
+	Chunk
+}
+
+func NewHashSection() *HashSection {
+	h := &HashSection{Chunk: NewChunk()}
+	h.Name = ".hash"
+	h.Shdr.Type = uint32(elf.SHT_HASH)
+	h.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	h.Shdr.AddrAlign = 4
+	h.Shdr.EntSize = 4
+	return h
+}
+
+func (h *HashSection) UpdateShdr(ctx *Context) {
+	numSyms := len(ctx.Dynsym.Symbols) + 1
+	h.Shdr.Size = uint64(2+numSyms*2) * 4
+	h.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+}
+
+func (h *HashSection) CopyBuf(ctx *Context) {
+	numSyms := len(ctx.Dynsym.Symbols) + 1
+	words := make([]uint32, 2+numSyms*2)
+	words[0] = uint32(numSyms)
+	words[1] = uint32(numSyms)
+	buckets := words[2 : 2+numSyms]
+	chains := words[2+numSyms:]
+
+	for i, sym := range ctx.Dynsym.Symbols {
+		idx := uint32(i + 1)
+		b := elfHash(getDynsymName(sym)) % uint32(numSyms)
+		chains[idx] = buckets[b]
+		buckets[b] = idx
+	}
+
+	utils.WriteSlice(ctx.Buf[h.Shdr.Offset:], words)
+}
+
+func elfHash(name string) uint32 {
+	h := uint32(0)
+	for i := 0; i < len(name); i++ {
+		h = h<<4 + uint32(name[i])
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+	return h
+}
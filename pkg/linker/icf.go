@@ -0,0 +1,260 @@
+package linker
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"unsafe"
+)
+
+type IcfMode = uint8
+
+const (
+	IcfModeNone IcfMode = iota
+	IcfModeAll
+	IcfModeSafe
+)
+
+func ParseIcfMode(arg string) (IcfMode, bool) {
+	switch arg {
+	case "none":
+		return IcfModeNone, true
+	case "all":
+		return IcfModeAll, true
+	case "safe":
+		return IcfModeSafe, true
+	}
+	return IcfModeNone, false
+}
+
+type icfDigest = [sha256.Size]byte
+
+func isIcfEligible(isec *InputSection) bool {
+	shdr := isec.Shdr()
+	name := isec.Name()
+	code := uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR)
+	return isec.IsAlive && shdr.Type == uint32(elf.SHT_PROGBITS) &&
+		shdr.Flags&code == code && shdr.Flags&uint64(elf.SHF_WRITE) == 0 &&
+		(name == ".text" || strings.HasPrefix(name, ".text."))
+}
+
+// markAddrTaken records the sections whose address is significant
+// according to the file's .llvm_addrsig table. Without the table any
+// of the file's sections may have its address compared.
+func markAddrTaken(o *ObjectFile, taken map[*InputSection]bool) {
+	if o.AddrsigSec == nil {
+		for _, isec := range o.Sections {
+			if isec != nil {
+				taken[isec] = true
+			}
+		}
+		return
+	}
+
+	data := o.GetBytesFromShdr(o.AddrsigSec)
+	for len(data) > 0 {
+		idx, rest, err := readUleb(data)
+		if err != nil || idx >= uint64(len(o.Symbols)) {
+			o.fatal("corrupted .llvm_addrsig section")
+		}
+		data = rest
+
+		if isec := o.Symbols[idx].InputSection; isec != nil {
+			taken[isec] = true
+		}
+	}
+}
+
+// collectIcfSections returns the sections that may be folded. With
+// --icf=safe that relies on .llvm_addrsig, which clang emits but GNU as
+// doesn't, so objects from GNU as have nothing that is safe to fold.
+func collectIcfSections(ctx *Context) []*InputSection {
+	taken := make(map[*InputSection]bool)
+	if ctx.Args.Icf == IcfModeSafe {
+		hasAddrsig := false
+		for _, file := range ctx.Objs {
+			markAddrTaken(file, taken)
+			hasAddrsig = hasAddrsig || file.AddrsigSec != nil
+		}
+
+		if !hasAddrsig && len(ctx.Objs) > 0 {
+			ctx.Warn(&LinkError{Err: errors.New("--icf=safe: no input has " +
+				"an .llvm_addrsig section, so no section can be folded")})
+		}
+	}
+
+	sections := make([]*InputSection, 0)
+	for _, file := range ctx.Objs {
+		for _, isec := range file.Sections {
+			if isec != nil && isIcfEligible(isec) && !taken[isec] {
+				sections = append(sections, isec)
+			}
+		}
+	}
+	return sections
+}
+
+func writeIcfUint(h hash.Hash, val uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], val)
+	h.Write(buf[:])
+}
+
+func pointerId[T any](p *T) uint64 {
+	return uint64(uintptr(unsafe.Pointer(p)))
+}
+
+// computeIcfDigest hashes everything about a section except the
+// identity of the foldable sections it refers to. Those are returned
+// as edges instead, and are resolved by iterating over the digests.
+func computeIcfDigest(
+	isec *InputSection, index map[*InputSection]int) (icfDigest, []int) {
+	h := sha256.New()
+	edges := make([]int, 0)
+
+	writeIcfUint(h, isec.Shdr().Flags)
+	writeIcfUint(h, uint64(isec.P2Align))
+	writeIcfUint(h, uint64(len(isec.Contents)))
+	h.Write(isec.Contents)
+
+	rels := isec.GetRels()
+	writeIcfUint(h, uint64(len(rels)))
+	for _, rel := range rels {
+		writeIcfUint(h, rel.Offset)
+		writeIcfUint(h, uint64(rel.Type))
+		writeIcfUint(h, uint64(rel.Addend))
+		if rel.Sym == 0 {
+			continue
+		}
+
+		sym := isec.File.Symbols[rel.Sym]
+		writeIcfUint(h, sym.Value)
+		switch {
+		case sym.SectionFragment != nil:
+			writeIcfUint(h, 1)
+			writeIcfUint(h, pointerId(sym.SectionFragment))
+		case sym.InputSection != nil:
+			if j, ok := index[sym.InputSection]; ok {
+				writeIcfUint(h, 2)
+				edges = append(edges, j)
+			} else {
+				writeIcfUint(h, 3)
+				writeIcfUint(h, pointerId(sym.InputSection))
+			}
+		default:
+			writeIcfUint(h, 4)
+			writeIcfUint(h, pointerId(sym))
+		}
+	}
+
+	var digest icfDigest
+	h.Sum(digest[:0])
+	return digest, edges
+}
+
+func countIcfClasses(digests []icfDigest) int {
+	classes := make(map[icfDigest]struct{}, len(digests))
+	for _, d := range digests {
+		classes[d] = struct{}{}
+	}
+	return len(classes)
+}
+
+// FoldIdenticalSections implements --icf. Sections start out grouped
+// by their own digest, and each round mixes in the digests of the
+// sections they refer to, until the number of classes stops growing.
+// That also folds mutually recursive functions. The first section of
+// each class in input order survives, and the symbols of the others
+// are redirected to it.
+func FoldIdenticalSections(ctx *Context) {
+	sections := collectIcfSections(ctx)
+	index := make(map[*InputSection]int, len(sections))
+	for i, isec := range sections {
+		index[isec] = i
+	}
+
+	digests0 := make([]icfDigest, len(sections))
+	edges := make([][]int, len(sections))
+	ctx.ParallelFor(len(sections), func(i int) {
+		digests0[i], edges[i] = computeIcfDigest(sections[i], index)
+	})
+
+	digests := make([]icfDigest, len(sections))
+	copy(digests, digests0)
+	next := make([]icfDigest, len(sections))
+	numClasses := countIcfClasses(digests)
+
+	for {
+		ctx.ParallelFor(len(sections), func(i int) {
+			h := sha256.New()
+			h.Write(digests0[i][:])
+			for _, j := range edges[i] {
+				h.Write(digests[j][:])
+			}
+			h.Sum(next[i][:0])
+		})
+
+		digests, next = next, digests
+		n := countIcfClasses(digests)
+		if n == numClasses {
+			break
+		}
+		numClasses = n
+	}
+
+	leaders := make(map[icfDigest]*InputSection)
+	folded := make(map[*InputSection]*InputSection)
+	for i, isec := range sections {
+		if leader, ok := leaders[digests[i]]; ok {
+			folded[isec] = leader
+			isec.IsAlive = false
+		} else {
+			leaders[digests[i]] = isec
+		}
+	}
+
+	ctx.ParallelFor(len(ctx.Objs), func(i int) {
+		file := ctx.Objs[i]
+		for _, sym := range file.Symbols {
+			if sym.File != file || sym.InputSection == nil {
+				continue
+			}
+			if leader, ok := folded[sym.InputSection]; ok {
+				sym.InputSection = leader
+			}
+		}
+	})
+
+	if ctx.Args.PrintIcfSections {
+		printIcfSections(ctx, sections, folded)
+	}
+}
+
+func printIcfSections(ctx *Context, sections []*InputSection,
+	folded map[*InputSection]*InputSection) {
+	members := make(map[*InputSection][]*InputSection)
+	for _, isec := range sections {
+		if leader, ok := folded[isec]; ok {
+			members[leader] = append(members[leader], isec)
+		}
+	}
+
+	name := func(isec *InputSection) string {
+		return fmt.Sprintf("%s:(%s)", isec.File.File.DisplayName(), isec.Name())
+	}
+
+	for _, isec := range sections {
+		if len(members[isec]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(ctx.Stdout, "selected section %s\n", name(isec))
+		for _, m := range members[isec] {
+			fmt.Fprintf(ctx.Stdout, "  removing identical section %s\n", name(m))
+		}
+	}
+}
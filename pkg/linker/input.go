@@ -1,37 +1,82 @@
 package linker
 
-import "github.com/ksco/rvld/pkg/utils"
-
-func ReadInputFiles(ctx *Context, remaining []string) {
-	for _, arg := range remaining {
-		var ok bool
-		if arg, ok = utils.RemovePrefix(arg, "-l"); ok {
-			ReadFile(ctx, FindLibrary(ctx, arg))
-		} else {
-			ReadFile(ctx, MustNewFile(arg))
-		}
+import (
+	"errors"
+	"github.com/ksco/rvld/pkg/utils"
+	"io"
+)
+
+// Input names one file to link. Name is a path (resolved through
+// Config.FS when set) or "-lfoo" for a library search. If Reader is
+// non-nil the contents are read from it instead and Name is only used
+// in diagnostics. Static and AsNeeded record whether -Bstatic and
+// --as-needed were in effect where the input appeared.
+type Input struct {
+	Name     string
+	Reader   io.ReaderAt
+	Size     int64
+	Static   bool
+	AsNeeded bool
+}
+
+// OpenInput returns the files an input stands for. That is the input
+// itself, unless it is a linker script listing other inputs.
+func OpenInput(ctx *Context, input Input) []*File {
+	var file *File
+	if input.Reader != nil {
+		file = MustNewFileFromReader(input.Name, input.Reader, input.Size)
+	} else if name, ok := utils.RemovePrefix(input.Name, "-l"); ok {
+		file = FindLibrary(ctx, name, input.Static)
+	} else {
+		file = MustNewFile(ctx, input.Name)
 	}
+
+	if GetFileType(file.Contents) == FileTypeText {
+		return ReadLinkerScript(ctx, file, input)
+	}
+	return []*File{file}
 }
 
-func ReadFile(ctx *Context, file *File) {
-	ft := GetFileType(file.Contents)
-	switch ft {
-	case FileTypeObject:
-		ctx.Objs = append(ctx.Objs, CreateObjectFile(ctx, file, false))
-	case FileTypeArchive:
-		for _, child := range ReadArchiveMembers(file) {
-			utils.Assert(GetFileType(child.Contents) == FileTypeObject)
-			ctx.Objs = append(ctx.Objs, CreateObjectFile(ctx, child, true))
+func ReadInputFiles(ctx *Context, files []*File) {
+	objs := make([]*File, 0)
+	inLib := make([]bool, 0)
+	for _, file := range files {
+		ft := GetFileType(file.Contents)
+		switch ft {
+		case FileTypeObject:
+			objs = append(objs, file)
+			inLib = append(inLib, false)
+		case FileTypeArchive:
+			for _, child := range ReadArchiveMembers(file) {
+				if GetFileType(child.Contents) != FileTypeObject {
+					fail(&LinkError{File: child.DisplayName(),
+						Err: errors.New("archive member is not an object file")})
+				}
+				objs = append(objs, child)
+				inLib = append(inLib, true)
+			}
+		case FileTypeShared:
+			fail(&LinkError{File: file.Name,
+				Err: errors.New("shared libraries are not supported")})
+		default:
+			fail(&LinkError{File: file.Name, Err: errors.New("unknown file type")})
 		}
-	default:
-		utils.Fatal("unknown file type")
 	}
+
+	ctx.Objs = make([]*ObjectFile, len(objs))
+	ctx.ParallelFor(len(objs), func(i int) {
+		ctx.Objs[i] = CreateObjectFile(ctx, objs[i], inLib[i], i)
+	})
+
+	RestoreSectionCreationOrder(ctx)
 }
 
-func CreateObjectFile(ctx *Context, file *File, inLib bool) *ObjectFile {
+func CreateObjectFile(
+	ctx *Context, file *File, inLib bool, priority int) *ObjectFile {
 	CheckFileCompatibility(ctx, file)
 
 	obj := NewObjectFile(file, !inLib)
+	obj.Priority = priority
 	obj.Parse(ctx)
 	return obj
 }
@@ -2,12 +2,13 @@ package linker
 
 import (
 	"debug/elf"
+	"errors"
 	"fmt"
-	"github.com/ksco/rvld/pkg/utils"
 )
 
 type InputFile struct {
 	File         *File
+	Class        elf.Class
 	ElfSections  []Shdr
 	ElfSyms      []Sym
 	FirstGlobal  int
@@ -19,56 +20,72 @@ type InputFile struct {
 }
 
 func NewInputFile(file *File) InputFile {
-	f := InputFile{File: file}
-	if len(file.Contents) < EhdrSize {
-		utils.Fatal("file too small")
+	f := InputFile{File: file, Class: GetElfClass(file.Contents)}
+	if f.Class != elf.ELFCLASS32 && f.Class != elf.ELFCLASS64 {
+		f.fatal("unknown ELF class")
+	}
+
+	if len(file.Contents) < GetEhdrSize(f.Class) {
+		f.fatal("file too small")
 	}
 
 	if !CheckMagic(file.Contents) {
-		utils.Fatal("not an ELF file")
+		f.fatal("not an ELF file")
+	}
+
+	shdrSize := GetShdrSize(f.Class)
+	ehdr := f.GetEhdr()
+	if ehdr.ShOff > uint64(len(file.Contents)) ||
+		uint64(len(file.Contents))-ehdr.ShOff < uint64(shdrSize) {
+		f.fatal("section header table is out of range")
 	}
 
-	ehdr := utils.Read[Ehdr](file.Contents)
 	contents := file.Contents[ehdr.ShOff:]
-	shdr := utils.Read[Shdr](contents)
+	shdr := ReadShdrs(f.Class, contents[:shdrSize])[0]
 
 	numSections := int64(ehdr.ShNum)
 	if numSections == 0 {
 		numSections = int64(shdr.Size)
 	}
 
-	f.ElfSections = []Shdr{shdr}
-	for numSections > 1 {
-		contents = contents[ShdrSize:]
-		f.ElfSections = append(f.ElfSections, utils.Read[Shdr](contents))
-		numSections--
+	if uint64(numSections) > uint64(len(contents)/shdrSize) {
+		f.fatal("section header table is out of range")
 	}
 
+	f.ElfSections = ReadShdrs(f.Class, contents[:numSections*int64(shdrSize)])
+
 	shstrndx := int64(ehdr.ShStrndx)
 	if ehdr.ShStrndx == uint16(elf.SHN_XINDEX) {
 		shstrndx = int64(shdr.Link)
 	}
 
+	if shstrndx >= numSections {
+		f.fatal(fmt.Sprintf("section name table index is out of range: %d",
+			shstrndx))
+	}
+
 	f.ShStrtab = f.GetBytesFromIdx(shstrndx)
 	return f
 }
 
 func (f *InputFile) GetBytesFromShdr(s *Shdr) []byte {
-	end := s.Offset + s.Size
-	if uint64(len(f.File.Contents)) < end {
-		utils.Fatal(
-			fmt.Sprintf("section header is out of range: %d", s.Offset))
+	size := uint64(len(f.File.Contents))
+	if s.Offset > size || size-s.Offset < s.Size {
+		f.fatal(fmt.Sprintf("section header is out of range: %d", s.Offset))
 	}
-	return f.File.Contents[s.Offset:end]
+	return f.File.Contents[s.Offset : s.Offset+s.Size]
 }
 
 func (f *InputFile) GetBytesFromIdx(idx int64) []byte {
+	if idx < 0 || idx >= int64(len(f.ElfSections)) {
+		f.fatal(fmt.Sprintf("section index is out of range: %d", idx))
+	}
 	return f.GetBytesFromShdr(&f.ElfSections[idx])
 }
 
 func (f *InputFile) FillUpElfSyms(s *Shdr) {
 	bs := f.GetBytesFromShdr(s)
-	f.ElfSyms = utils.ReadSlice[Sym](bs, SymSize)
+	f.ElfSyms = ReadSyms(f.Class, bs)
 }
 
 func (f *InputFile) FindSection(ty uint32) *Shdr {
@@ -82,6 +99,10 @@ func (f *InputFile) FindSection(ty uint32) *Shdr {
 	return nil
 }
 
+func (f *InputFile) fatal(msg string) {
+	fail(&LinkError{File: f.File.DisplayName(), Err: errors.New(msg)})
+}
+
 func (f *InputFile) GetEhdr() Ehdr {
-	return utils.Read[Ehdr](f.File.Contents)
+	return ReadEhdr(f.Class, f.File.Contents)
 }
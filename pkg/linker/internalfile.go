@@ -0,0 +1,105 @@
+package linker
+
+import (
+	"debug/elf"
+	"math"
+)
+
+var arrayBoundaries = []string{"__preinit_array", "__init_array", "__fini_array"}
+
+// CreateInternalFile defines the linker-provided symbols that some input
+// file refers to but none defines, and the symbols given by --defsym,
+// which take precedence over any other definition. They belong to a
+// synthetic object file, so relocations and the symbol table treat them
+// like any other definition. Their values are filled in by
+// FixInternalSymbols.
+func CreateInternalFile(ctx *Context) {
+	obj := &ObjectFile{
+		InputFile: InputFile{
+			File:        &File{Name: "<internal>"},
+			Class:       ctx.Class(),
+			IsAlive:     true,
+			FirstGlobal: 1,
+			ElfSyms:     []Sym{{}},
+		},
+		Priority: math.MaxInt,
+	}
+	obj.LocalSymbols = []Symbol{*NewSymbol("")}
+	obj.LocalSymbols[0].File = obj
+	obj.Symbols = []*Symbol{&obj.LocalSymbols[0]}
+
+	add := func(sym *Symbol, visibility elf.SymVis) {
+		sym.File = obj
+		sym.Value = 0
+		sym.SymIdx = len(obj.ElfSyms)
+		sym.SetInputSection(nil)
+		obj.ElfSyms = append(obj.ElfSyms, Sym{
+			Info:  uint8(elf.STB_GLOBAL) << 4,
+			Other: uint8(visibility),
+			Shndx: uint16(elf.SHN_ABS),
+		})
+		obj.Symbols = append(obj.Symbols, sym)
+	}
+
+	define := func(name string) {
+		sym, ok := ctx.SymbolMap.Get(name)
+		if !ok || sym.File != nil {
+			return
+		}
+		add(sym, elf.STV_HIDDEN)
+	}
+
+	for _, stem := range arrayBoundaries {
+		define(stem + "_start")
+		define(stem + "_end")
+	}
+
+	for _, d := range ctx.Args.Defsyms {
+		if sym := GetSymbolByName(ctx, d.Name); sym.File != obj {
+			add(sym, elf.STV_DEFAULT)
+		}
+	}
+
+	ctx.InternalObj = obj
+}
+
+func FixInternalSymbols(ctx *Context) {
+	obj := ctx.InternalObj
+	set := func(name string, val uint64) {
+		if sym, ok := ctx.SymbolMap.Get(name); ok && sym.File == obj {
+			sym.Value = val
+			obj.ElfSyms[sym.SymIdx].Val = val
+		}
+	}
+
+	find := func(name string) Chunker {
+		for _, chunk := range ctx.Chunks {
+			if chunk.GetName() == name {
+				return chunk
+			}
+		}
+		return nil
+	}
+
+	for _, stem := range arrayBoundaries {
+		if chunk := find("." + stem[2:]); chunk != nil {
+			shdr := chunk.GetShdr()
+			set(stem+"_start", shdr.Addr)
+			set(stem+"_end", shdr.Addr+shdr.Size)
+		}
+	}
+
+	// A --defsym may refer to one given before it, so they are
+	// evaluated in command line order.
+	for _, d := range ctx.Args.Defsyms {
+		val := d.Addend
+		if d.Target != "" {
+			target, ok := ctx.SymbolMap.Get(d.Target)
+			if !ok || target.File == nil {
+				fatal("--defsym: undefined symbol: " + d.Target)
+			}
+			val += target.GetAddr()
+		}
+		set(d.Name, val)
+	}
+}
@@ -0,0 +1,195 @@
+package linker
+
+import (
+	"context"
+	"errors"
+	"github.com/ksco/rvld/pkg/utils"
+	"io"
+	"io/fs"
+)
+
+type Config struct {
+	Args   ContextArgs
+	Inputs []Input
+
+	// FS, if non-nil, is used to open inputs and search libraries
+	// instead of the host file system.
+	FS fs.FS
+
+	Output io.WriterAt
+
+	// MapFile receives the link map when Args.MapFile is set.
+	MapFile io.Writer
+
+	// Stdout receives -M, --cref and --trace-symbol output.
+	// If nil, that output is discarded.
+	Stdout io.Writer
+}
+
+type Result struct {
+	Size     int64
+	Entry    uint64
+	Warnings []error
+}
+
+func Link(ctx context.Context, cfg Config) (res Result, err error) {
+	defer recoverLinkError(&err)
+
+	if cfg.Output == nil {
+		return res, &LinkError{Err: errors.New("no output specified")}
+	}
+
+	if cfg.Args.MapFile != "" && cfg.MapFile == nil {
+		return res, &LinkError{File: cfg.Args.MapFile,
+			Err: errors.New("no map file output specified")}
+	}
+
+	c := NewContext()
+	defer c.UnmapFiles()
+	c.Args = cfg.Args
+	c.FS = cfg.FS
+	c.Stdout = cfg.Stdout
+	if c.Stdout == nil {
+		c.Stdout = io.Discard
+	}
+	c.MapFile = cfg.MapFile
+
+	files := make([]*File, 0, len(cfg.Inputs))
+	for _, input := range cfg.Inputs {
+		files = append(files, OpenInput(c, input)...)
+	}
+
+	if c.Args.Emulation == MachineTypeNone {
+		for _, file := range files {
+			c.Args.Emulation = GetMachineTypeFromContents(file.Contents)
+			if c.Args.Emulation != MachineTypeNone {
+				break
+			}
+		}
+	}
+
+	if c.Args.Relocatable && c.Args.OFormat != OutputFormatElf {
+		fatal("-r and --oformat can't be used together")
+	}
+
+	if c.Args.Relocatable && c.Args.Icf != IcfModeNone {
+		fatal("-r and --icf can't be used together")
+	}
+
+	if c.Args.Relocatable && c.Args.GdbIndex {
+		fatal("-r and --gdb-index can't be used together")
+	}
+
+	if c.Args.Relocatable && len(c.Args.Defsyms) > 0 {
+		fatal("-r and --defsym can't be used together")
+	}
+
+	if c.Args.CompressDebugSections == CompressionTypeZstd && !utils.CanZstd {
+		fatal("--compress-debug-sections=zstd: zstd support is not compiled in")
+	}
+
+	c.Target = GetTarget(c.Args.Emulation)
+	if c.Target == nil {
+		fatal("unknown emulation type")
+	}
+
+	if c.Args.VersionScript != "" {
+		c.VersionScript = ReadVersionScript(c, c.Args.VersionScript)
+	}
+
+	for _, filename := range c.Args.DynamicLists {
+		if c.DynamicList == nil {
+			c.DynamicList = &VersionScript{}
+		}
+		list := ReadDynamicList(c, filename)
+		c.DynamicList.Nodes = append(c.DynamicList.Nodes, list.Nodes...)
+	}
+
+	for _, name := range c.Args.TraceSymbols {
+		GetSymbolByName(c, name).Traced = true
+	}
+
+	for _, name := range c.Args.Wrap {
+		sym := GetSymbolByName(c, name)
+		sym.Redirect = GetSymbolByName(c, "__wrap_"+name)
+		GetSymbolByName(c, "__real_"+name).Redirect = sym
+	}
+
+	mustNo(ctx.Err())
+	ReadInputFiles(c, files)
+
+	mustNo(ctx.Err())
+	ResolveSymbols(c)
+	c.Target.CheckFlags(c)
+	if !c.Args.Relocatable {
+		CreateInternalFile(c)
+	}
+
+	mustNo(ctx.Err())
+	RegisterSectionPieces(c)
+	if c.Args.Icf != IcfModeNone {
+		FoldIdenticalSections(c)
+	}
+
+	mustNo(ctx.Err())
+	ComputeMergedSectionSizes(c)
+	CreateSyntheticSections(c)
+	BinSections(c)
+	SortInputSections(c)
+	c.Chunks = append(c.Chunks, CollectOutputSections(c)...)
+
+	mustNo(ctx.Err())
+	if !c.Args.Relocatable {
+		ScanRelocations(c)
+	}
+
+	mustNo(ctx.Err())
+	ComputeSectionSizes(c)
+	if c.Args.Relocatable || c.Args.EmitRelocs {
+		CreateRelocatableSections(c)
+	}
+	SortOutputSections(c)
+	ComputeSectionHeaders(c)
+
+	for _, chunk := range c.Chunks {
+		chunk.UpdateShdr(c)
+	}
+
+	fileSize := SetOutputSectionOffsets(c)
+	if c.InternalObj != nil {
+		FixInternalSymbols(c)
+	}
+
+	mustNo(ctx.Err())
+	if c.GdbIndex != nil {
+		c.GdbIndex.Build(c)
+		fileSize = SetOutputSectionOffsets(c)
+	}
+
+	mustNo(ctx.Err())
+	if c.Args.CompressDebugSections != CompressionTypeNone {
+		CompressDebugSections(c)
+		fileSize = SetOutputSectionOffsets(c)
+	}
+
+	if c.Args.PrintMap || c.Args.MapFile != "" || c.Args.Cref {
+		WriteMapFile(c)
+	}
+
+	mustNo(ctx.Err())
+	out := OpenOutputFile(c, cfg.Output, fileSize)
+	c.Buf = out.Buf
+	CopyChunks(c)
+
+	mustNo(ctx.Err())
+	if c.BuildId != nil {
+		c.BuildId.WriteBuildId(c)
+	}
+
+	res.Size = out.Close(c)
+	if !c.Args.Relocatable {
+		res.Entry = getEntryAddr(c)
+	}
+	res.Warnings = c.Warnings
+	return res, nil
+}
@@ -0,0 +1,267 @@
+package linker_test
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"github.com/ksco/rvld/pkg/linker"
+	"github.com/ksco/rvld/pkg/utils"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type bufferAt struct {
+	buf []byte
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	contents, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func link(cfg linker.Config) (*bufferAt, linker.Result, error) {
+	if cfg.Args.Output == "" {
+		cfg.Args = linker.NewContextArgs()
+	}
+	cfg.Args.NoStdlib = true
+	out := &bufferAt{}
+	cfg.Output = out
+	res, err := linker.Link(context.Background(), cfg)
+	return out, res, err
+}
+
+func TestLinkFromFS(t *testing.T) {
+	obj := readFixture(t, "riscv64.o")
+	fsys := fstest.MapFS{
+		"src/a.o": {Data: obj},
+		// Like glibc's libc.so, a library may be a linker script.
+		"lib/libfoo.so": {Data: []byte("GROUP ( src/a.o )\n")},
+	}
+
+	for _, input := range []string{"src/a.o", "-lfoo"} {
+		args := linker.NewContextArgs()
+		args.LibraryPaths = []string{"lib"}
+		out, res, err := link(linker.Config{
+			Args:   args,
+			Inputs: []linker.Input{{Name: input}},
+			FS:     fsys,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+
+		f, err := elf.NewFile(bytes.NewReader(out.buf))
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if res.Size != int64(len(out.buf)) || res.Entry != f.Entry {
+			t.Errorf("%s: result %+v doesn't describe the output", input, res)
+		}
+	}
+}
+
+func TestLinkFromReader(t *testing.T) {
+	obj := readFixture(t, "riscv64.o")
+	out, res, err := link(linker.Config{
+		Inputs: []linker.Input{{
+			Name:   "a.o",
+			Reader: bytes.NewReader(obj),
+			Size:   int64(len(obj)),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Size == 0 || res.Size != int64(len(out.buf)) {
+		t.Errorf("got size %d for %d bytes of output", res.Size, len(out.buf))
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	obj := readFixture(t, "riscv64.o")
+
+	noNote := readFixture(t, "riscv64.o")
+	noNote = bytes.Replace(noNote, []byte(".note.GNU-stack"),
+		[]byte(".note.GNU-stacc"), 1)
+
+	fsys := fstest.MapFS{
+		"a.o":       {Data: obj},
+		"no-note.o": {Data: noNote},
+	}
+
+	// Header fields pointing outside the file, as e_shoff,
+	// e_shnum and e_shstrndx.
+	for _, field := range []struct {
+		off int
+		val []byte
+	}{
+		{0x28, []byte{0xf0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{0x3c, []byte{0xff, 0x7f}},
+		{0x3e, []byte{0xf0, 0x7f}},
+	} {
+		bad := append([]byte{}, obj...)
+		copy(bad[field.off:], field.val)
+		_, _, err := link(linker.Config{
+			Inputs: []linker.Input{{Name: "bad.o"}},
+			FS:     fstest.MapFS{"bad.o": {Data: bad}},
+		})
+		var linkErr *linker.LinkError
+		if !errors.As(err, &linkErr) || linkErr.File != "bad.o" ||
+			!strings.Contains(err.Error(), "out of range") || linkErr.Stack != nil {
+			t.Errorf("bad field at 0x%x: got %v", field.off, err)
+		}
+	}
+
+	_, _, err := link(linker.Config{
+		Inputs: []linker.Input{{Name: "missing.o"}},
+		FS:     fsys,
+	})
+	var linkErr *linker.LinkError
+	if !errors.As(err, &linkErr) || linkErr.File != "missing.o" ||
+		!errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing input: got %v", err)
+	}
+
+	_, _, err = link(linker.Config{
+		Inputs: []linker.Input{{Name: "-lmissing"}},
+		FS:     fsys,
+	})
+	if !errors.As(err, &linkErr) || linkErr.File != "-lmissing" {
+		t.Errorf("missing library: got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = linker.Link(ctx, linker.Config{
+		Args:   linker.NewContextArgs(),
+		Inputs: []linker.Input{{Name: "a.o"}},
+		FS:     fsys,
+		Output: &bufferAt{},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled link: got %v", err)
+	}
+
+	_, err = linker.Link(context.Background(), linker.Config{
+		Args:   linker.NewContextArgs(),
+		Inputs: []linker.Input{{Name: "a.o"}},
+		FS:     fsys,
+	})
+	if err == nil {
+		t.Error("link without output succeeded")
+	}
+
+	if !utils.CanZstd {
+		args := linker.NewContextArgs()
+		args.CompressDebugSections = linker.CompressionTypeZstd
+		_, _, err = link(linker.Config{
+			Args:   args,
+			Inputs: []linker.Input{{Name: "a.o"}},
+			FS:     fsys,
+		})
+		if !errors.As(err, &linkErr) || linkErr.Stack != nil {
+			t.Errorf("zstd without zstd support: got %v", err)
+		}
+	}
+
+	// Warnings are returned rather than printed.
+	_, res, err := link(linker.Config{
+		Inputs: []linker.Input{{Name: "no-note.o"}},
+		FS:     fsys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !errors.As(res.Warnings[0], &linkErr) ||
+		linkErr.File != "no-note.o" {
+		t.Errorf("got warnings %v", res.Warnings)
+	}
+}
+
+func TestLinkMapFile(t *testing.T) {
+	obj := readFixture(t, "riscv64.o")
+	fsys := fstest.MapFS{"a.o": {Data: obj}}
+
+	args := linker.NewContextArgs()
+	args.MapFile = "a.map"
+	var mapFile bytes.Buffer
+	_, _, err := link(linker.Config{
+		Args:    args,
+		Inputs:  []linker.Input{{Name: "a.o"}},
+		FS:      fsys,
+		MapFile: &mapFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mapFile.String(), "a.o:(.text)") {
+		t.Errorf("map doesn't list a.o:(.text):\n%s", mapFile.String())
+	}
+
+	_, _, err = link(linker.Config{
+		Args:   args,
+		Inputs: []linker.Input{{Name: "a.o"}},
+		FS:     fsys,
+	})
+	var linkErr *linker.LinkError
+	if !errors.As(err, &linkErr) || linkErr.File != "a.map" {
+		t.Errorf("map file without a writer: got %v", err)
+	}
+}
+
+// Inputs and outputs on disk are mmap'd, while those from an fs.FS or
+// an in-memory writer are copied; both must give the same output.
+func TestLinkMmap(t *testing.T) {
+	obj := readFixture(t, "riscv64.o")
+	want, _, err := link(linker.Config{
+		Inputs: []linker.Input{{Name: "a.o"}},
+		FS:     fstest.MapFS{"a.o": {Data: obj}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stale bytes of a longer file must not survive in the output.
+	path := t.TempDir() + "/out"
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xff}, 1<<20), 0666); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	args := linker.NewContextArgs()
+	args.NoStdlib = true
+	_, err = linker.Link(context.Background(), linker.Config{
+		Args:   args,
+		Inputs: []linker.Input{{Name: "testdata/riscv64.o"}},
+		Output: file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.buf) {
+		t.Errorf("mmap'd output differs: %d bytes, want %d", len(got), len(want.buf))
+	}
+}
@@ -0,0 +1,94 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ksco/rvld/pkg/utils"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// LinkError describes a failure that stopped the link. The location
+// fields are filled in as far as they are known at the point of failure.
+type LinkError struct {
+	File    string
+	Section string
+	Offset  uint64
+	Symbol  string
+	Err     error
+
+	// Stack is set for internal errors, such as an index out of range
+	// on malformed input, and holds the stack where they happened.
+	Stack []byte
+}
+
+func (e *LinkError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Section != "" {
+			fmt.Fprintf(&b, ":(%s)", e.Section)
+			if e.Offset != 0 {
+				fmt.Fprintf(&b, "+0x%x", e.Offset)
+			}
+		}
+		b.WriteString(": ")
+	}
+
+	if e.Symbol != "" {
+		fmt.Fprintf(&b, "%s: ", e.Symbol)
+	}
+
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+// Failures deep inside the passes unwind to Link via panic, which turns
+// them back into an ordinary error return.
+func fail(e *LinkError) {
+	panic(e)
+}
+
+func fatal(msg string) {
+	fail(&LinkError{Err: errors.New(msg)})
+}
+
+func mustNo(err error) {
+	if err != nil {
+		fail(&LinkError{Err: err})
+	}
+}
+
+func assert(condition bool) {
+	if !condition {
+		fatal("assert failed")
+	}
+}
+
+func recoverLinkError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	if p, ok := r.(*utils.Panic); ok {
+		r, stack = p.Value, p.Stack
+	}
+
+	switch e := r.(type) {
+	case *LinkError:
+		*err = e
+	case runtime.Error:
+		*err = &LinkError{Err: fmt.Errorf("internal error: %w", e), Stack: stack}
+	case error:
+		*err = &LinkError{Err: e}
+	default:
+		*err = &LinkError{Err: fmt.Errorf("internal error: %v", r), Stack: stack}
+	}
+}
@@ -0,0 +1,102 @@
+package linker
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ReadLinkerScript returns the files named by a linker script given in
+// place of an input, as glibc does for libc.so. Only the commands that
+// list inputs are supported.
+func ReadLinkerScript(ctx *Context, file *File, input Input) []*File {
+	l := newScriptLexer(file.Contents, "(),;")
+	files := make([]*File, 0)
+
+	next := func() string {
+		tok, err := l.next()
+		if err != nil {
+			fail(&LinkError{File: file.Name, Err: err})
+		}
+		return tok
+	}
+
+	expect := func(want string) {
+		if err := l.expect(want); err != nil {
+			fail(&LinkError{File: file.Name, Err: err})
+		}
+	}
+
+	unexpected := func(tok string) {
+		if tok == "" {
+			fail(&LinkError{File: file.Name,
+				Err: l.errorf("unexpected end of script")})
+		}
+		fail(&LinkError{File: file.Name, Err: l.errorf("unexpected '%s'", tok)})
+	}
+
+	var readInputs func(asNeeded bool)
+	readInputs = func(asNeeded bool) {
+		for {
+			tok := next()
+			switch tok {
+			case ")":
+				return
+			case ",":
+				continue
+			case "", "(", ";":
+				unexpected(tok)
+			case "AS_NEEDED":
+				expect("(")
+				readInputs(true)
+				continue
+			}
+
+			files = append(files, OpenInput(ctx, Input{
+				Name:     resolveScriptPath(ctx, file.Name, strings.Trim(tok, `"`)),
+				Static:   input.Static,
+				AsNeeded: asNeeded,
+			})...)
+		}
+	}
+
+	for {
+		switch tok := next(); tok {
+		case "":
+			return files
+		case ";":
+		case "INPUT", "GROUP":
+			expect("(")
+			readInputs(input.AsNeeded)
+		case "OUTPUT_FORMAT", "OUTPUT_ARCH":
+			expect("(")
+			for tok := next(); tok != ")"; tok = next() {
+				if tok == "" || tok == "(" {
+					unexpected(tok)
+				}
+			}
+		default:
+			fail(&LinkError{File: file.Name,
+				Err: l.errorf("unsupported linker script command: %s", tok)})
+		}
+	}
+}
+
+// resolveScriptPath finds the file a linker script refers to. Like
+// "=" paths, absolute paths in a script inside the sysroot are taken
+// to be relative to the sysroot.
+func resolveScriptPath(ctx *Context, script, name string) string {
+	if strings.HasPrefix(name, "-l") {
+		return name
+	}
+
+	if path := expandSysroot(ctx, name); path != name {
+		return path
+	}
+
+	sysroot := ctx.Args.Sysroot
+	if sysroot != "" && filepath.IsAbs(name) && strings.HasPrefix(
+		filepath.Clean(script), filepath.Clean(sysroot)+string(filepath.Separator)) {
+		return filepath.Join(sysroot, name)
+	}
+	return name
+}
@@ -10,6 +10,8 @@ type MachineType = uint8
 const (
 	MachineTypeNone    MachineType = iota
 	MachineTypeRISCV64 MachineType = iota
+	MachineTypeRISCV32 MachineType = iota
+	MachineTypeX86_64  MachineType = iota
 )
 
 func GetMachineTypeFromContents(contents []byte) MachineType {
@@ -17,12 +19,11 @@ func GetMachineTypeFromContents(contents []byte) MachineType {
 
 	switch ft {
 	case FileTypeObject:
-		machine := utils.Read[uint16](contents[18:])
-		if machine == uint16(elf.EM_RISCV) {
-			class := elf.Class(contents[4])
-			switch class {
-			case elf.ELFCLASS64:
-				return MachineTypeRISCV64
+		machine := elf.Machine(utils.Read[uint16](contents[18:]))
+		class := GetElfClass(contents)
+		for _, t := range targets {
+			if t.Machine() == machine && t.Class() == class {
+				return t.MachineType()
 			}
 		}
 	}
@@ -38,8 +39,12 @@ func (m MachineTypeStringer) String() string {
 	switch m.MachineType {
 	case MachineTypeRISCV64:
 		return "riscv64"
+	case MachineTypeRISCV32:
+		return "riscv32"
+	case MachineTypeX86_64:
+		return "x86_64"
 	}
 
-	utils.Assert(m.MachineType == MachineTypeNone)
+	assert(m.MachineType == MachineTypeNone)
 	return "none"
 }
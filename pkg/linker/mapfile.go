@@ -0,0 +1,217 @@
+package linker
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+func WriteMapFile(ctx *Context) {
+	w := ctx.Stdout
+	if ctx.Args.MapFile != "" {
+		w = ctx.MapFile
+	}
+
+	out := bufio.NewWriter(w)
+	if ctx.Args.PrintMap || ctx.Args.MapFile != "" {
+		printMap(ctx, out)
+	}
+
+	if ctx.Args.Cref {
+		printCref(ctx, out)
+	}
+
+	if err := out.Flush(); err != nil {
+		fail(&LinkError{File: ctx.Args.MapFile, Err: err})
+	}
+}
+
+func printMap(ctx *Context, out io.Writer) {
+	syms := collectMapSymbols(ctx)
+
+	fmt.Fprintf(out, "%16s %16s %8s %5s %s\n",
+		"VMA", "LMA", "Size", "Align", "Out     In      Symbol")
+
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		name := chunk.GetName()
+		if name == "" {
+			name = "<" + chunkKind(ctx, chunk) + ">"
+		}
+
+		addr := shdr.Addr
+		if shdr.Flags&uint64(elf.SHF_ALLOC) == 0 {
+			addr = 0
+		}
+
+		fmt.Fprintf(out, "%016x %016x %08x %5d %s\n",
+			addr, getLoadAddr(ctx, addr), shdr.Size, shdr.AddrAlign, name)
+
+		switch c := chunk.(type) {
+		case *OutputSection:
+			for _, isec := range c.Members {
+				fmt.Fprintf(out, "%016x %016x %08x %5d         %s:(%s) +0x%x\n",
+					isec.GetAddr(), getLoadAddr(ctx, isec.GetAddr()), isec.ShSize,
+					1<<isec.P2Align, isec.File.File.DisplayName(),
+					isec.Name(), isec.Offset)
+
+				for _, sym := range syms[isec] {
+					fmt.Fprintf(out, "%016x %16s %8s %5s                 %s\n",
+						sym.GetAddr(), "", "", "", sym.Name)
+				}
+			}
+		case *MergedSection:
+			printMergedSectionStats(ctx, out, c)
+		}
+	}
+
+	printDiscardedSections(ctx, out)
+}
+
+// getLoadAddr returns the LMA of a VMA, which is where the PT_LOAD
+// segment containing it is loaded.
+func getLoadAddr(ctx *Context, addr uint64) uint64 {
+	if ctx.Phdr == nil || addr == 0 {
+		return addr
+	}
+
+	for _, phdr := range ctx.Phdr.Phdrs {
+		if phdr.Type == uint32(elf.PT_LOAD) &&
+			phdr.VAddr <= addr && addr < phdr.VAddr+phdr.MemSize {
+			return phdr.PAddr + addr - phdr.VAddr
+		}
+	}
+	return addr
+}
+
+func chunkKind(ctx *Context, chunk Chunker) string {
+	switch chunk {
+	case ctx.Ehdr:
+		return "ehdr"
+	case ctx.Phdr:
+		return "phdr"
+	case ctx.Shdr:
+		return "shdr"
+	}
+	return "synthetic"
+}
+
+func collectMapSymbols(ctx *Context) map[*InputSection][]*Symbol {
+	syms := make(map[*InputSection][]*Symbol)
+	for _, file := range ctx.Objs {
+		for i, sym := range file.Symbols {
+			if i == 0 || sym.File != file || sym.InputSection == nil ||
+				sym.Name == "" || strings.HasPrefix(sym.Name, ".L") {
+				continue
+			}
+
+			typ := sym.ElfSym().Type()
+			if typ == uint8(elf.STT_SECTION) || typ == uint8(elf.STT_FILE) {
+				continue
+			}
+
+			syms[sym.InputSection] = append(syms[sym.InputSection], sym)
+		}
+	}
+
+	for _, vec := range syms {
+		sort.SliceStable(vec, func(i, j int) bool {
+			return vec[i].Value < vec[j].Value
+		})
+	}
+
+	return syms
+}
+
+func printMergedSectionStats(ctx *Context, out io.Writer, m *MergedSection) {
+	numInputs := 0
+	numPieces := 0
+	inputSize := uint64(0)
+	for _, file := range ctx.Objs {
+		for _, ms := range file.MergeableSections {
+			if ms == nil || ms.Parent != m {
+				continue
+			}
+
+			numInputs++
+			numPieces += len(ms.Strs)
+			for _, str := range ms.Strs {
+				inputSize += uint64(len(str))
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "%16s %16s %8s %5s         "+
+		"<merged: %d input sections, %d pieces, %d unique, "+
+		"0x%x -> 0x%x bytes>\n",
+		"", "", "", "", numInputs, numPieces, m.Map.Len(),
+		inputSize, m.Shdr.Size)
+}
+
+func printDiscardedSections(ctx *Context, out io.Writer) {
+	fmt.Fprintf(out, "\nDiscarded input sections\n\n")
+	for _, file := range ctx.Objs {
+		for _, isec := range file.DiscardedSections {
+			fmt.Fprintf(out, "%08x %s:(%s) [comdat]\n",
+				isec.ShSize, file.File.DisplayName(), isec.Name())
+		}
+
+		for i, isec := range file.Sections {
+			if isec == nil || isec.IsAlive || file.MergeableSections[i] != nil {
+				continue
+			}
+			fmt.Fprintf(out, "%08x %s:(%s)\n",
+				isec.ShSize, file.File.DisplayName(), isec.Name())
+		}
+	}
+}
+
+func printCref(ctx *Context, out io.Writer) {
+	refs := make(map[*Symbol][]*ObjectFile)
+	for _, file := range ctx.Objs {
+		for _, sym := range file.Symbols[file.FirstGlobal:] {
+			if sym.File == file {
+				continue
+			}
+
+			files := refs[sym]
+			if len(files) == 0 || files[len(files)-1] != file {
+				refs[sym] = append(files, file)
+			}
+		}
+	}
+
+	syms := make([]*Symbol, 0)
+	ctx.SymbolMap.ForEach(func(name string, sym *Symbol) {
+		if sym.File != nil || len(refs[sym]) > 0 {
+			syms = append(syms, sym)
+		}
+	})
+
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].Name < syms[j].Name
+	})
+
+	fmt.Fprintf(out, "\nCross Reference Table\n\n")
+	fmt.Fprintf(out, "%-50s%s\n", "Symbol", "File")
+	for _, sym := range syms {
+		name := sym.Name
+		def := "<undefined>"
+		if sym.File != nil {
+			def = sym.File.File.DisplayName()
+		}
+
+		if len(name) >= 50 {
+			fmt.Fprintf(out, "%s\n%-50s%s\n", name, "", def)
+		} else {
+			fmt.Fprintf(out, "%-50s%s\n", name, def)
+		}
+
+		for _, file := range refs[sym] {
+			fmt.Fprintf(out, "%-50s%s\n", "", file.File.DisplayName())
+		}
+	}
+}
@@ -4,18 +4,19 @@ import (
 	"debug/elf"
 	"github.com/ksco/rvld/pkg/utils"
 	"sort"
+	"sync/atomic"
 )
 
 type MergedSection struct {
 	Chunk
-	Map map[string]*SectionFragment
+	Map *utils.ConcurrentMap[SectionFragment]
 }
 
 func NewMergedSection(
 	name string, flags uint64, typ uint32) *MergedSection {
 	m := &MergedSection{
 		Chunk: NewChunk(),
-		Map:   make(map[string]*SectionFragment),
+		Map:   utils.NewConcurrentMap[SectionFragment](),
 	}
 
 	m.Name = name
@@ -30,6 +31,9 @@ func GetMergedSectionInstance(
 	flags = flags & ^uint64(elf.SHF_GROUP) & ^uint64(elf.SHF_MERGE) &
 		^uint64(elf.SHF_STRINGS) & ^uint64(elf.SHF_COMPRESSED)
 
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
+
 	find := func() *MergedSection {
 		for _, osec := range ctx.MergedSections {
 			if name == osec.Name && flags == osec.Shdr.Flags &&
@@ -52,14 +56,16 @@ func GetMergedSectionInstance(
 
 func (m *MergedSection) Insert(
 	key string, p2align uint32) *SectionFragment {
-	frag, ok := m.Map[key]
-	if !ok {
-		frag = NewSectionFragment(m)
-		m.Map[key] = frag
-	}
+	frag, _ := m.Map.GetOrInsert(key, func() *SectionFragment {
+		return NewSectionFragment(m)
+	})
 
-	if frag.P2Align < p2align {
-		frag.P2Align = p2align
+	for {
+		old := atomic.LoadUint32(&frag.P2Align)
+		if old >= p2align ||
+			atomic.CompareAndSwapUint32(&frag.P2Align, old, p2align) {
+			break
+		}
 	}
 
 	return frag
@@ -71,12 +77,12 @@ func (m *MergedSection) AssignOffsets() {
 		Val *SectionFragment
 	}
 
-	for key := range m.Map {
+	m.Map.ForEach(func(key string, frag *SectionFragment) {
 		fragments = append(fragments, struct {
 			Key string
 			Val *SectionFragment
-		}{Key: key, Val: m.Map[key]})
-	}
+		}{Key: key, Val: frag})
+	})
 
 	sort.SliceStable(fragments, func(i, j int) bool {
 		x := fragments[i]
@@ -107,10 +113,11 @@ func (m *MergedSection) AssignOffsets() {
 }
 
 func (m *MergedSection) CopyBuf(ctx *Context) {
-	buf := ctx.Buf[m.Shdr.Offset:]
-	for key := range m.Map {
-		if frag, ok := m.Map[key]; ok {
-			copy(buf[frag.Offset:], key)
-		}
-	}
+	m.WriteTo(ctx, ctx.Buf[m.Shdr.Offset:])
+}
+
+func (m *MergedSection) WriteTo(ctx *Context, buf []byte) {
+	m.Map.ForEach(func(key string, frag *SectionFragment) {
+		copy(buf[frag.Offset:], key)
+	})
 }
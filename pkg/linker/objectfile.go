@@ -3,16 +3,31 @@ package linker
 import (
 	"bytes"
 	"debug/elf"
+	"errors"
+	"fmt"
 	"github.com/ksco/rvld/pkg/utils"
 	"math"
+	"strings"
 )
 
 type ObjectFile struct {
 	InputFile
 	SymtabSec         *Shdr
 	SymtabShndxSec    []uint32
+	AddrsigSec        *Shdr
 	Sections          []*InputSection
 	MergeableSections []*MergeableSection
+	ComdatGroups      []ComdatGroupRef
+	DiscardedSections []*InputSection
+	RiscvAttributes   *RiscvAttributes
+	NeedsExecStack    bool
+	HasGnuStack       bool
+
+	// Priority is the position of the file on the command line; when
+	// several files define the same symbol, the lowest priority wins.
+	Priority int
+
+	traceLog []string
 }
 
 func NewObjectFile(file *File, isAlive bool) *ObjectFile {
@@ -32,7 +47,10 @@ func (o *ObjectFile) Parse(ctx *Context) {
 	o.InitializeSections(ctx)
 	o.InitializeSymbols(ctx)
 	o.InitializeMergeableSections(ctx)
-	o.SkipEhframeSections()
+	if !ctx.Args.Relocatable {
+		o.SkipEhframeSections()
+	}
+	o.ReadRiscvAttributes()
 }
 
 func (o *ObjectFile) InitializeSections(ctx *Context) {
@@ -40,13 +58,25 @@ func (o *ObjectFile) InitializeSections(ctx *Context) {
 	for i := 0; i < len(o.ElfSections); i++ {
 		shdr := &o.ElfSections[i]
 		switch elf.SectionType(shdr.Type) {
-		case elf.SHT_GROUP, elf.SHT_SYMTAB, elf.SHT_STRTAB, elf.SHT_REL, elf.SHT_RELA,
+		case elf.SHT_GROUP:
+			o.ReadComdatGroup(ctx, shdr)
+		case elf.SHT_SYMTAB, elf.SHT_STRTAB, elf.SHT_REL, elf.SHT_RELA,
 			elf.SHT_NULL:
 			break
 		case elf.SHT_SYMTAB_SHNDX:
 			o.FillUpSymtabShndxSec(shdr)
+		case elf.SectionType(SHT_LLVM_ADDRSIG):
+			o.AddrsigSec = shdr
 		default:
 			name := ElfGetName(o.InputFile.ShStrtab, shdr.Name)
+			if name == ".note.GNU-stack" && !ctx.Args.Relocatable {
+				o.NeedsExecStack = shdr.Flags&uint64(elf.SHF_EXECINSTR) != 0
+				o.HasGnuStack = true
+				continue
+			}
+			if ctx.Args.StripDebug && strings.HasPrefix(name, ".debug") {
+				continue
+			}
 			o.Sections[i] = NewInputSection(ctx, name, o, uint32(i))
 		}
 	}
@@ -57,14 +87,69 @@ func (o *ObjectFile) InitializeSections(ctx *Context) {
 			continue
 		}
 
-		utils.Assert(shdr.Info < uint32(len(o.Sections)))
+		assert(shdr.Info < uint32(len(o.Sections)))
 		if target := o.Sections[shdr.Info]; target != nil {
-			utils.Assert(target.RelsecIdx == math.MaxUint32)
+			assert(target.RelsecIdx == math.MaxUint32)
 			target.RelsecIdx = uint32(i)
 		}
 	}
 }
 
+func (o *ObjectFile) ReadComdatGroup(ctx *Context, shdr *Shdr) {
+	assert(int(shdr.Info) < len(o.ElfSyms))
+	esym := &o.ElfSyms[shdr.Info]
+	signature := ElfGetName(o.SymbolStrtab, esym.Name)
+	if esym.Type() == uint8(elf.STT_SECTION) {
+		signature = ElfGetName(o.ShStrtab,
+			o.ElfSections[o.GetShndx(esym, int(shdr.Info))].Name)
+	}
+
+	entries := utils.ReadSlice[uint32](o.GetBytesFromShdr(shdr), 4)
+	if len(entries) == 0 {
+		o.fatal("empty SHT_GROUP")
+	}
+
+	if entries[0]&GRP_COMDAT == 0 {
+		return
+	}
+
+	o.ComdatGroups = append(o.ComdatGroups, ComdatGroupRef{
+		Group:   GetComdatGroupByName(ctx, signature),
+		SymIdx:  shdr.Info,
+		Members: entries[1:],
+	})
+}
+
+func (o *ObjectFile) EliminateDuplicateComdatGroups() []*Symbol {
+	for _, ref := range o.ComdatGroups {
+		if ref.Group.Owner == o {
+			continue
+		}
+
+		for _, idx := range ref.Members {
+			isec := o.Sections[idx]
+			if isec == nil {
+				continue
+			}
+
+			isec.IsAlive = false
+			o.DiscardedSections = append(o.DiscardedSections, isec)
+			o.Sections[idx] = nil
+			o.MergeableSections[idx] = nil
+		}
+	}
+
+	cleared := make([]*Symbol, 0)
+	for _, sym := range o.Symbols[o.FirstGlobal:] {
+		if sym.File == o && sym.InputSection != nil &&
+			o.Sections[sym.InputSection.Shndx] == nil {
+			sym.Clear()
+			cleared = append(cleared, sym)
+		}
+	}
+	return cleared
+}
+
 func (o *ObjectFile) FillUpSymtabShndxSec(s *Shdr) {
 	bs := o.GetBytesFromShdr(s)
 	o.SymtabShndxSec = utils.ReadSlice[uint32](bs, 4)
@@ -102,12 +187,26 @@ func (o *ObjectFile) InitializeSymbols(ctx *Context) {
 	for i := len(o.LocalSymbols); i < len(o.ElfSyms); i++ {
 		esym := &o.ElfSyms[i]
 		name := ElfGetName(o.SymbolStrtab, esym.Name)
-		o.Symbols[i] = GetSymbolByName(ctx, name)
+
+		// foo@@VER is the default version of foo, so it defines foo.
+		// foo@VER stays a separate symbol that only references naming
+		// that version resolve to.
+		if !ctx.Args.Relocatable && !esym.IsUndef() {
+			if at := strings.Index(name, "@@"); at > 0 {
+				name = name[:at]
+			}
+		}
+
+		sym := GetSymbolByName(ctx, name)
+		if esym.IsUndef() && sym.Redirect != nil {
+			sym = sym.Redirect
+		}
+		o.Symbols[i] = sym
 	}
 }
 
 func (o *ObjectFile) GetShndx(esym *Sym, idx int) int64 {
-	utils.Assert(idx >= 0 && idx < len(o.ElfSyms))
+	assert(idx >= 0 && idx < len(o.ElfSyms))
 
 	if esym.Shndx == uint16(elf.SHN_XINDEX) {
 		return int64(o.SymtabShndxSec[idx])
@@ -115,38 +214,58 @@ func (o *ObjectFile) GetShndx(esym *Sym, idx int) int64 {
 	return int64(esym.Shndx)
 }
 
-func (o *ObjectFile) ResolveSymbols() {
+func (o *ObjectFile) ResolveSymbols(ctx *Context) {
 	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
-		sym := o.Symbols[i]
-		esym := &o.ElfSyms[i]
+		o.ResolveSymbol(ctx, i)
+	}
+}
 
-		if esym.IsUndef() {
-			continue
-		}
+func (o *ObjectFile) ResolveSymbol(ctx *Context, i int) {
+	sym := o.Symbols[i]
+	esym := &o.ElfSyms[i]
 
-		var isec *InputSection
-		if !esym.IsAbs() {
-			isec = o.GetSection(esym, i)
-			if isec == nil {
-				continue
-			}
+	if esym.IsUndef() {
+		if sym.Traced {
+			o.tracef("%s: reference to %s", o.File.DisplayName(), sym.Name)
 		}
+		return
+	}
 
-		if sym.File == nil {
-			sym.File = o
-			sym.SetInputSection(isec)
-			sym.Value = esym.Val
-			sym.SymIdx = i
+	var isec *InputSection
+	if !esym.IsAbs() {
+		isec = o.GetSection(esym, i)
+		if isec == nil {
+			return
 		}
 	}
+
+	if sym.Traced {
+		o.tracef("%s: definition of %s", o.File.DisplayName(), sym.Name)
+	}
+
+	sym.Mu.Lock()
+	defer sym.Mu.Unlock()
+
+	if sym.File == nil || o.Priority < sym.File.Priority {
+		sym.File = o
+		sym.SetInputSection(isec)
+		sym.Value = esym.Val
+		sym.SymIdx = i
+	}
+}
+
+// Resolution runs on many files at once; trace output is collected per
+// file and printed in command line order afterwards.
+func (o *ObjectFile) tracef(format string, a ...any) {
+	o.traceLog = append(o.traceLog, fmt.Sprintf(format, a...))
 }
 
 func (o *ObjectFile) GetSection(esym *Sym, idx int) *InputSection {
 	return o.Sections[o.GetShndx(esym, idx)]
 }
 
-func (o *ObjectFile) MarkLiveObjects(feeder func(*ObjectFile)) {
-	utils.Assert(o.IsAlive)
+func (o *ObjectFile) MarkLiveObjects(ctx *Context, feeder func(*ObjectFile)) {
+	assert(o.IsAlive)
 
 	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
 		sym := o.Symbols[i]
@@ -157,6 +276,11 @@ func (o *ObjectFile) MarkLiveObjects(feeder func(*ObjectFile)) {
 		}
 
 		if esym.IsUndef() && !sym.File.IsAlive {
+			if sym.Traced {
+				o.tracef("%s: reference to %s pulls in %s",
+					o.File.DisplayName(), sym.Name, sym.File.File.DisplayName())
+			}
+
 			sym.File.IsAlive = true
 			feeder(sym.File)
 		}
@@ -173,6 +297,12 @@ func (o *ObjectFile) ClearSymbols() {
 
 func (o *ObjectFile) InitializeMergeableSections(ctx *Context) {
 	o.MergeableSections = make([]*MergeableSection, len(o.Sections))
+
+	// A partial link copies mergeable sections as they are.
+	if ctx.Args.Relocatable {
+		return
+	}
+
 	for i := 0; i < len(o.Sections); i++ {
 		isec := o.Sections[i]
 		if isec != nil && isec.IsAlive &&
@@ -206,13 +336,17 @@ func splitSection(ctx *Context, isec *InputSection) *MergeableSection {
 		shdr.Flags)
 	m.P2Align = isec.P2Align
 
+	if shdr.EntSize == 0 {
+		isec.fatal(0, "mergeable section has zero entsize")
+	}
+
 	data := isec.Contents
 	offset := uint64(0)
 	if shdr.Flags&uint64(elf.SHF_STRINGS) != 0 {
 		for len(data) > 0 {
 			end := findNull(data, int(shdr.EntSize))
 			if end == -1 {
-				utils.Fatal("string is not null terminated")
+				isec.fatal(offset, "string is not null terminated")
 			}
 
 			sz := uint64(end) + shdr.EntSize
@@ -224,7 +358,7 @@ func splitSection(ctx *Context, isec *InputSection) *MergeableSection {
 		}
 	} else {
 		if uint64(len(data))%shdr.EntSize != 0 {
-			utils.Fatal("section size is not multiple of entsize")
+			isec.fatal(0, "section size is not multiple of entsize")
 		}
 
 		for len(data) > 0 {
@@ -256,7 +390,8 @@ func (o *ObjectFile) RegisterSectionPieces() {
 		sym := o.Symbols[i]
 		esym := &o.ElfSyms[i]
 
-		if esym.IsAbs() || esym.IsUndef() || esym.IsCommon() {
+		if esym.IsAbs() || esym.IsUndef() || esym.IsCommon() ||
+			sym.File != o {
 			continue
 		}
 
@@ -267,7 +402,11 @@ func (o *ObjectFile) RegisterSectionPieces() {
 
 		frag, fragOffset := m.GetFragment(uint32(esym.Val))
 		if frag == nil {
-			utils.Fatal("bad symbol value")
+			fail(&LinkError{
+				File:   o.File.DisplayName(),
+				Symbol: sym.Name,
+				Err:    errors.New("bad symbol value"),
+			})
 		}
 		sym.SetSectionFragment(frag)
 		sym.Value = uint64(fragOffset)
@@ -282,11 +421,29 @@ func (o *ObjectFile) SkipEhframeSections() {
 	}
 }
 
-func (o *ObjectFile) ScanRelocations() {
+// The attributes of all inputs are merged into one synthetic section,
+// so the input sections themselves are not copied to the output.
+func (o *ObjectFile) ReadRiscvAttributes() {
+	for _, isec := range o.Sections {
+		if isec == nil || isec.Shdr().Type != SHT_RISCV_ATTRIBUTES {
+			continue
+		}
+
+		attrs, err := ParseRiscvAttributes(isec.Contents)
+		if err != nil {
+			isec.fatal(0, err.Error())
+		}
+
+		o.RiscvAttributes = attrs
+		isec.IsAlive = false
+	}
+}
+
+func (o *ObjectFile) ScanRelocations(ctx *Context) {
 	for _, isec := range o.Sections {
 		if isec != nil && isec.IsAlive &&
 			isec.Shdr().Flags&uint64(elf.SHF_ALLOC) != 0 {
-			isec.ScanRelocations()
+			ctx.Target.ScanRelocations(ctx, isec)
 		}
 	}
 }
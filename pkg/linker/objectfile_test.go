@@ -0,0 +1,42 @@
+package linker
+
+import (
+	"github.com/ksco/rvld/pkg/utils"
+	"os"
+	"testing"
+)
+
+// BenchmarkParseObject compares parsing with the ELF structures accessed
+// in place against decoding them through encoding/binary as before.
+func BenchmarkParseObject(b *testing.B) {
+	if !utils.HostIsLittleEndian {
+		b.Skip("in-place access needs a little-endian host")
+	}
+
+	contents, err := os.ReadFile("testdata/bench.o")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	parse := func(b *testing.B) {
+		ctx := NewContext()
+		ctx.Args.Emulation = MachineTypeRISCV64
+		b.SetBytes(int64(len(contents)))
+		for i := 0; i < b.N; i++ {
+			obj := NewObjectFile(&File{Name: "bench.o", Contents: contents}, true)
+			obj.Parse(ctx)
+			for _, isec := range obj.Sections {
+				if isec != nil {
+					isec.GetRels()
+				}
+			}
+		}
+	}
+
+	b.Run("binary", func(b *testing.B) {
+		utils.HostIsLittleEndian = false
+		defer func() { utils.HostIsLittleEndian = true }()
+		parse(b)
+	})
+	b.Run("in-place", parse)
+}
@@ -2,6 +2,7 @@ package linker
 
 import (
 	"debug/elf"
+	"path"
 	"strings"
 )
 
@@ -11,6 +12,27 @@ var prefixes = []string{
 	".ctors.", ".dtors.",
 }
 
+// getCtorsOutput maps the legacy .ctors and .dtors tables onto the
+// arrays that replaced them. Each table is walked in the opposite
+// direction of its array, so the entries are written in reverse.
+func getCtorsOutput(name string) (string, elf.SectionType, bool) {
+	switch {
+	case name == ".ctors" || strings.HasPrefix(name, ".ctors."):
+		return ".init_array", elf.SHT_INIT_ARRAY, true
+	case name == ".dtors" || strings.HasPrefix(name, ".dtors."):
+		return ".fini_array", elf.SHT_FINI_ARRAY, true
+	}
+	return "", 0, false
+}
+
+// isCrtFile reports whether file is one of GCC's crtbegin*.o or
+// crtend*.o, whose .ctors and .dtors hold the list terminators.
+func isCrtFile(file *ObjectFile) bool {
+	name := path.Base(file.File.Name)
+	return strings.HasSuffix(name, ".o") &&
+		(strings.HasPrefix(name, "crtbegin") || strings.HasPrefix(name, "crtend"))
+}
+
 func GetOutputName(name string, flags uint64) string {
 	if (name == ".rodata" || strings.HasPrefix(name, ".rodata.")) &&
 		flags&uint64(elf.SHF_MERGE) != 0 {
@@ -1,10 +1,7 @@
 package linker
 
 import (
-	"bytes"
 	"debug/elf"
-	"encoding/binary"
-	"github.com/ksco/rvld/pkg/utils"
 )
 
 type OutputEhdr struct {
@@ -21,6 +18,11 @@ func NewOutputEhdr() *OutputEhdr {
 	}}
 }
 
+func (o *OutputEhdr) UpdateShdr(ctx *Context) {
+	o.Shdr.Size = uint64(GetEhdrSize(ctx.Class()))
+	o.Shdr.AddrAlign = ctx.WordSize()
+}
+
 func getEntryAddr(ctx *Context) uint64 {
 	for _, osec := range ctx.OutputSections {
 		if osec.Name == ".text" {
@@ -30,42 +32,32 @@ func getEntryAddr(ctx *Context) uint64 {
 	return 0
 }
 
-func getFlags(ctx *Context) uint32 {
-	utils.Assert(len(ctx.Objs) > 0)
-	flags := ctx.Objs[0].GetEhdr().Flags
-	for _, obj := range ctx.Objs[1:] {
-		if obj.GetEhdr().Flags&EF_RISCV_RVC != 0 {
-			flags |= EF_RISCV_RVC
-			break
-		}
-	}
-
-	return flags
-}
-
 func (o *OutputEhdr) CopyBuf(ctx *Context) {
 	ehdr := &Ehdr{}
 	WriteMagic(ehdr.Ident[:])
-	ehdr.Ident[elf.EI_CLASS] = uint8(elf.ELFCLASS64)
+	ehdr.Ident[elf.EI_CLASS] = uint8(ctx.Class())
 	ehdr.Ident[elf.EI_DATA] = uint8(elf.ELFDATA2LSB)
 	ehdr.Ident[elf.EI_VERSION] = uint8(elf.EV_CURRENT)
 	ehdr.Ident[elf.EI_OSABI] = 0
 	ehdr.Ident[elf.EI_ABIVERSION] = 0
 	ehdr.Type = uint16(elf.ET_EXEC)
-	ehdr.Machine = uint16(elf.EM_RISCV)
+	ehdr.Machine = uint16(ctx.Target.Machine())
 	ehdr.Version = uint32(elf.EV_CURRENT)
-	ehdr.Entry = getEntryAddr(ctx)
-	ehdr.PhOff = ctx.Phdr.Shdr.Offset
 	ehdr.ShOff = ctx.Shdr.Shdr.Offset
-	ehdr.Flags = getFlags(ctx)
-	ehdr.EhSize = uint16(EhdrSize)
-	ehdr.PhEntSize = uint16(PhdrSize)
-	ehdr.PhNum = uint16(ctx.Phdr.Shdr.Size) / uint16(PhdrSize)
-	ehdr.ShEntSize = uint16(ShdrSize)
-	ehdr.ShNum = uint16(ctx.Shdr.Shdr.Size) / uint16(ShdrSize)
+	ehdr.Flags = ctx.Target.GetEhdrFlags(ctx)
+	ehdr.EhSize = uint16(GetEhdrSize(ctx.Class()))
+	ehdr.ShEntSize = uint16(GetShdrSize(ctx.Class()))
+	ehdr.ShNum = uint16(ctx.Shdr.Shdr.Size / uint64(ehdr.ShEntSize))
+	ehdr.ShStrndx = uint16(ctx.ShStrtab.Shndx)
+
+	if ctx.Args.Relocatable {
+		ehdr.Type = uint16(elf.ET_REL)
+	} else {
+		ehdr.Entry = getEntryAddr(ctx)
+		ehdr.PhOff = ctx.Phdr.Shdr.Offset
+		ehdr.PhEntSize = uint16(GetPhdrSize(ctx.Class()))
+		ehdr.PhNum = uint16(len(ctx.Phdr.Phdrs))
+	}
 
-	buf := &bytes.Buffer{}
-	err := binary.Write(buf, binary.LittleEndian, ehdr)
-	utils.MustNo(err)
-	copy(ctx.Buf[o.Shdr.Offset:], buf.Bytes())
+	WriteEhdr(ctx.Class(), ctx.Buf[o.Shdr.Offset:], *ehdr)
 }
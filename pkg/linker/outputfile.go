@@ -0,0 +1,52 @@
+package linker
+
+import (
+	"github.com/ksco/rvld/pkg/utils"
+	"io"
+	"os"
+)
+
+type OutputFile struct {
+	Buf    []byte
+	writer io.WriterAt
+	mapped bool
+}
+
+// OpenOutputFile sets up the buffer the chunks are copied into. When the
+// destination is a regular file and no conversion is needed afterwards,
+// the buffer is the file itself mapped into memory.
+func OpenOutputFile(ctx *Context, w io.WriterAt, size uint64) *OutputFile {
+	o := &OutputFile{writer: w}
+
+	if file, ok := w.(*os.File); ok && utils.CanMmap && size > 0 &&
+		ctx.Args.OFormat == OutputFormatElf {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			// Truncate to zero first so no stale bytes survive in
+			// the padding between chunks.
+			mustNo(file.Truncate(0))
+			mustNo(utils.Fallocate(file, int64(size)))
+			if buf, err := utils.Mmap(file, int(size), true); err == nil {
+				o.Buf = buf
+				o.mapped = true
+				return o
+			}
+		}
+	}
+
+	o.Buf = make([]byte, size)
+	return o
+}
+
+func (o *OutputFile) Close(ctx *Context) int64 {
+	if o.mapped {
+		mustNo(utils.Munmap(o.Buf))
+		return int64(len(o.Buf))
+	}
+
+	buf := EncodeOutput(ctx)
+	_, err := o.writer.WriteAt(buf, 0)
+	if err != nil {
+		fail(&LinkError{File: ctx.Args.Output, Err: err})
+	}
+	return int64(len(buf))
+}
@@ -0,0 +1,209 @@
+package linker
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"math"
+)
+
+type OutputFormat = uint8
+
+const (
+	OutputFormatElf OutputFormat = iota
+	OutputFormatBinary
+	OutputFormatIHex
+	OutputFormatSRec
+)
+
+func GetOutputFormatFromName(name string) (OutputFormat, bool) {
+	switch name {
+	case "elf", "elf64-littleriscv", "elf32-littleriscv", "elf64-x86-64":
+		return OutputFormatElf, true
+	case "binary":
+		return OutputFormatBinary, true
+	case "ihex":
+		return OutputFormatIHex, true
+	case "srec":
+		return OutputFormatSRec, true
+	}
+	return OutputFormatElf, false
+}
+
+// EncodeOutput serializes the linked image in ctx.Buf according to
+// ctx.Args.OFormat. Non-ELF formats hold the PT_LOAD segments, laid out
+// by physical address.
+func EncodeOutput(ctx *Context) []byte {
+	if ctx.Args.OFormat == OutputFormatElf {
+		return ctx.Buf
+	}
+
+	base, image := flattenSegments(ctx)
+	entry := getEntryAddr(ctx)
+
+	switch ctx.Args.OFormat {
+	case OutputFormatBinary:
+		return image
+	case OutputFormatIHex:
+		return encodeIHex(base, image, entry)
+	case OutputFormatSRec:
+		return encodeSRec(base, image, entry)
+	}
+
+	fatal("unknown output format")
+	return nil
+}
+
+// flattenSegments copies the file contents of each PT_LOAD segment to
+// its physical address. The ELF and program headers share a segment
+// with the read-only sections, but a flashed image has no use for them,
+// so like objcopy, a segment starts at the first section it holds.
+func flattenSegments(ctx *Context) (uint64, []byte) {
+	type extent struct {
+		paddr  uint64
+		offset uint64
+		size   uint64
+	}
+
+	extents := make([]extent, 0)
+	for _, phdr := range ctx.Phdr.Phdrs {
+		if phdr.Type != uint32(elf.PT_LOAD) || phdr.FileSize == 0 {
+			continue
+		}
+
+		begin := uint64(math.MaxUint64)
+		end := phdr.Offset + phdr.FileSize
+		for _, chunk := range ctx.Chunks {
+			if chunk == Chunker(ctx.Ehdr) || chunk == Chunker(ctx.Phdr) ||
+				chunk == Chunker(ctx.Shdr) {
+				continue
+			}
+
+			shdr := chunk.GetShdr()
+			if shdr.Flags&uint64(elf.SHF_ALLOC) != 0 && shdr.Size > 0 &&
+				shdr.Type != uint32(elf.SHT_NOBITS) &&
+				phdr.Offset <= shdr.Offset && shdr.Offset < end &&
+				shdr.Offset < begin {
+				begin = shdr.Offset
+			}
+		}
+
+		if begin < end {
+			extents = append(extents, extent{
+				paddr:  phdr.PAddr + begin - phdr.Offset,
+				offset: begin,
+				size:   end - begin,
+			})
+		}
+	}
+
+	start := uint64(math.MaxUint64)
+	end := uint64(0)
+	for _, e := range extents {
+		if e.paddr < start {
+			start = e.paddr
+		}
+		if e.paddr+e.size > end {
+			end = e.paddr + e.size
+		}
+	}
+
+	if start > end {
+		return 0, nil
+	}
+
+	image := bytes.Repeat([]byte{ctx.Args.GapFill}, int(end-start))
+	for _, e := range extents {
+		copy(image[e.paddr-start:], ctx.Buf[e.offset:e.offset+e.size])
+	}
+
+	return start, image
+}
+
+func checkAddrFits32(base uint64, size int, entry uint64) {
+	if base+uint64(size) > math.MaxUint32+1 || entry > math.MaxUint32 {
+		fatal("address out of range for 32-bit output format")
+	}
+}
+
+func encodeIHex(base uint64, image []byte, entry uint64) []byte {
+	checkAddrFits32(base, len(image), entry)
+
+	buf := &bytes.Buffer{}
+	record := func(typ uint8, addr uint16, data []byte) {
+		sum := uint8(len(data)) + uint8(addr>>8) + uint8(addr) + typ
+		fmt.Fprintf(buf, ":%02X%04X%02X", len(data), addr, typ)
+		for _, b := range data {
+			fmt.Fprintf(buf, "%02X", b)
+			sum += b
+		}
+		fmt.Fprintf(buf, "%02X\n", uint8(-sum))
+	}
+
+	upper := uint32(math.MaxUint32)
+	for pos := 0; pos < len(image); {
+		addr := uint32(base) + uint32(pos)
+		if addr>>16 != upper {
+			upper = addr >> 16
+			record(0x04, 0, []byte{uint8(upper >> 8), uint8(upper)})
+		}
+
+		// A data record must not cross a 64 KiB boundary.
+		n := 16
+		if n > len(image)-pos {
+			n = len(image) - pos
+		}
+		if rem := 0x10000 - int(addr&0xffff); n > rem {
+			n = rem
+		}
+
+		record(0x00, uint16(addr), image[pos:pos+n])
+		pos += n
+	}
+
+	record(0x05, 0, []byte{
+		uint8(entry >> 24), uint8(entry >> 16),
+		uint8(entry >> 8), uint8(entry),
+	})
+	record(0x01, 0, nil)
+	return buf.Bytes()
+}
+
+func encodeSRec(base uint64, image []byte, entry uint64) []byte {
+	checkAddrFits32(base, len(image), entry)
+
+	buf := &bytes.Buffer{}
+	record := func(typ byte, addr []byte, data []byte) {
+		count := uint8(len(addr) + len(data) + 1)
+		sum := count
+		fmt.Fprintf(buf, "S%c%02X", typ, count)
+		for _, b := range addr {
+			fmt.Fprintf(buf, "%02X", b)
+			sum += b
+		}
+		for _, b := range data {
+			fmt.Fprintf(buf, "%02X", b)
+			sum += b
+		}
+		fmt.Fprintf(buf, "%02X\n", ^sum)
+	}
+
+	addr32 := func(val uint32) []byte {
+		return []byte{
+			uint8(val >> 24), uint8(val >> 16), uint8(val >> 8), uint8(val),
+		}
+	}
+
+	record('0', []byte{0, 0}, []byte("rvld"))
+
+	for pos := 0; pos < len(image); pos += 16 {
+		end := pos + 16
+		if end > len(image) {
+			end = len(image)
+		}
+		record('3', addr32(uint32(base)+uint32(pos)), image[pos:end])
+	}
+
+	record('7', addr32(uint32(entry)), nil)
+	return buf.Bytes()
+}
@@ -2,6 +2,7 @@ package linker
 
 import (
 	"debug/elf"
+	"errors"
 	"github.com/ksco/rvld/pkg/utils"
 	"math"
 )
@@ -9,7 +10,8 @@ import (
 type OutputPhdr struct {
 	Chunk
 
-	Phdrs []Phdr
+	Phdrs     []Phdr
+	ExecStack bool
 }
 
 func NewOutputPhdr() *OutputPhdr {
@@ -31,6 +33,14 @@ func toPhdrFlags(chunk Chunker) uint32 {
 	return ret
 }
 
+func isTls(chunk Chunker) bool {
+	return chunk.GetShdr().Flags&uint64(elf.SHF_TLS) != 0
+}
+
+func isBss(chunk Chunker) bool {
+	return chunk.GetShdr().Type == uint32(elf.SHT_NOBITS) && !isTls(chunk)
+}
+
 func createPhdr(ctx *Context) []Phdr {
 	vec := make([]Phdr, 0)
 	define := func(typ, flags uint64, minAlign int64, chunk Chunker) {
@@ -67,15 +77,7 @@ func createPhdr(ctx *Context) []Phdr {
 			phdr.VAddr
 	}
 
-	define(uint64(elf.PT_PHDR), uint64(elf.PF_R), 8, ctx.Phdr)
-
-	isTls := func(chunk Chunker) bool {
-		return chunk.GetShdr().Flags&uint64(elf.SHF_TLS) != 0
-	}
-
-	isBss := func(chunk Chunker) bool {
-		return chunk.GetShdr().Type == uint32(elf.SHT_NOBITS) && !isTls(chunk)
-	}
+	define(uint64(elf.PT_PHDR), uint64(elf.PF_R), int64(ctx.WordSize()), ctx.Phdr)
 
 	isNote := func(chunk Chunker) bool {
 		shdr := chunk.GetShdr()
@@ -121,7 +123,8 @@ func createPhdr(ctx *Context) []Phdr {
 			}
 
 			flags := toPhdrFlags(first)
-			define(uint64(elf.PT_LOAD), uint64(flags), PageSize, first)
+			define(uint64(elf.PT_LOAD), uint64(flags),
+				int64(ctx.MaxPageSize()), first)
 
 			if !isBss(first) {
 				for i < end && !isBss(chunks[i]) &&
@@ -139,6 +142,11 @@ func createPhdr(ctx *Context) []Phdr {
 		}
 	}
 
+	if ctx.Dynamic != nil {
+		define(uint64(elf.PT_DYNAMIC), uint64(toPhdrFlags(ctx.Dynamic)),
+			int64(ctx.WordSize()), ctx.Dynamic)
+	}
+
 	for i := 0; i < len(ctx.Chunks); i++ {
 		if !isTls(ctx.Chunks[i]) {
 			continue
@@ -154,17 +162,77 @@ func createPhdr(ctx *Context) []Phdr {
 		}
 
 		phdr := &vec[len(vec)-1]
-		ctx.TpAddr = phdr.VAddr
+		ctx.TpAddr = ctx.Target.GetTpAddr(phdr)
+		ctx.TlsBegin = phdr.VAddr
+	}
+
+	vec = append(vec, Phdr{
+		Type:  uint32(elf.PT_GNU_STACK),
+		Flags: uint32(elf.PF_R | elf.PF_W),
+		Align: 1,
+	})
+	if ctx.Phdr.ExecStack {
+		vec[len(vec)-1].Flags |= uint32(elf.PF_X)
+	}
+
+	// .tbss takes no address space, so it must not stretch the segment
+	// over the data that follows.
+	for i := 0; i < len(ctx.Chunks); i++ {
+		if !isRelro(ctx, ctx.Chunks[i]) || isTbss(ctx.Chunks[i]) {
+			continue
+		}
+
+		define(uint64(elf.PT_GNU_RELRO), uint64(elf.PF_R), 1, ctx.Chunks[i])
+		for i++; i < len(ctx.Chunks) && isRelro(ctx, ctx.Chunks[i]); i++ {
+			if !isTbss(ctx.Chunks[i]) {
+				push(ctx.Chunks[i])
+			}
+		}
+
+		phdr := &vec[len(vec)-1]
+		phdr.MemSize = utils.AlignTo(phdr.VAddr+phdr.MemSize,
+			ctx.CommonPageSize()) - phdr.VAddr
+		phdr.Align = 1
+		break
+	}
+
+	if ctx.RiscvAttributes != nil {
+		define(uint64(PT_RISCV_ATTRIBUTES), uint64(elf.PF_R), 1,
+			ctx.RiscvAttributes)
 	}
 
 	return vec
 }
 
+// needsExecStack decides the flags of PT_GNU_STACK. As with GNU ld, an
+// object without .note.GNU-stack may have been written for an
+// executable stack.
+func needsExecStack(ctx *Context) bool {
+	if ctx.Args.ZExecStack || ctx.Args.ZNoExecStack {
+		return ctx.Args.ZExecStack
+	}
+
+	execStack := false
+	for _, file := range ctx.Objs {
+		if !file.HasGnuStack {
+			ctx.Warn(&LinkError{
+				File: file.File.DisplayName(),
+				Err: errors.New(
+					"missing .note.GNU-stack section implies executable stack"),
+			})
+			return true
+		}
+		execStack = execStack || file.NeedsExecStack
+	}
+	return execStack
+}
+
 func (o *OutputPhdr) UpdateShdr(ctx *Context) {
 	o.Phdrs = createPhdr(ctx)
-	o.Shdr.Size = uint64(len(o.Phdrs)) * uint64(PhdrSize)
+	o.Shdr.Size = uint64(len(o.Phdrs)) * uint64(GetPhdrSize(ctx.Class()))
+	o.Shdr.AddrAlign = ctx.WordSize()
 }
 
 func (o *OutputPhdr) CopyBuf(ctx *Context) {
-	utils.Write(ctx.Buf[o.Shdr.Offset:], o.Phdrs)
+	WritePhdrs(ctx.Class(), ctx.Buf[o.Shdr.Offset:], o.Phdrs)
 }
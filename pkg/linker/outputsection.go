@@ -22,18 +22,33 @@ func (o *OutputSection) CopyBuf(ctx *Context) {
 	if o.Shdr.Type == uint32(elf.SHT_NOBITS) {
 		return
 	}
+	o.WriteTo(ctx, ctx.Buf[o.Shdr.Offset:])
+}
 
-	base := ctx.Buf[o.Shdr.Offset:]
+// WriteTo copies the members one after another. It is called from
+// within ParallelFor, and CopyChunks splits large sections up itself.
+func (o *OutputSection) WriteTo(ctx *Context, buf []byte) {
 	for _, isec := range o.Members {
-		isec.WriteTo(ctx, base[isec.Offset:])
+		isec.WriteTo(ctx, buf[isec.Offset:])
 	}
 }
 
 func GetOutputSection(
 	ctx *Context, name string, typ, flags uint64) *OutputSection {
-	name = GetOutputName(name, flags)
-	flags = flags &^ uint64(elf.SHF_GROUP) &^
-		uint64(elf.SHF_COMPRESSED) &^ uint64(elf.SHF_LINK_ORDER)
+	// A partial link keeps input section names, and gives every member
+	// of a section group its own output section so that the group can
+	// be written out again.
+	group := ctx.Args.Relocatable && flags&uint64(elf.SHF_GROUP) != 0
+	if !ctx.Args.Relocatable {
+		name = GetOutputName(name, flags)
+	}
+	if !group {
+		flags &^= uint64(elf.SHF_GROUP)
+	}
+	flags = flags &^ uint64(elf.SHF_COMPRESSED) &^ uint64(elf.SHF_LINK_ORDER)
+
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
 
 	find := func() *OutputSection {
 		for _, osec := range ctx.OutputSections {
@@ -45,7 +60,7 @@ func GetOutputSection(
 		return nil
 	}
 
-	if osec := find(); osec != nil {
+	if osec := find(); osec != nil && !group {
 		return osec
 	}
 
@@ -1,7 +1,5 @@
 package linker
 
-import "github.com/ksco/rvld/pkg/utils"
-
 type OutputShdr struct {
 	Chunk
 }
@@ -13,10 +11,24 @@ func NewOutputShdr() *OutputShdr {
 }
 
 func (o *OutputShdr) UpdateShdr(ctx *Context) {
-	o.Shdr.Size = 1 * uint64(ShdrSize)
+	n := int64(0)
+	for _, chunk := range ctx.Chunks {
+		if chunk.GetShndx() > n {
+			n = chunk.GetShndx()
+		}
+	}
+
+	o.Shdr.Size = uint64(n+1) * uint64(GetShdrSize(ctx.Class()))
+	o.Shdr.AddrAlign = ctx.WordSize()
 }
 
 func (o *OutputShdr) CopyBuf(ctx *Context) {
 	base := ctx.Buf[o.Shdr.Offset:]
-	utils.Write[Shdr](base, Shdr{})
+	shdrs := make([]Shdr, o.Shdr.Size/uint64(GetShdrSize(ctx.Class())))
+	for _, chunk := range ctx.Chunks {
+		if shndx := chunk.GetShndx(); shndx > 0 {
+			shdrs[shndx] = *chunk.GetShdr()
+		}
+	}
+	WriteShdrs(ctx.Class(), base, shdrs)
 }
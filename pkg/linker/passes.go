@@ -2,16 +2,55 @@ package linker
 
 import (
 	"debug/elf"
+	"fmt"
 	"github.com/ksco/rvld/pkg/utils"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 )
 
-func ResolveSymbols(ctx *Context) {
+// Input files are parsed in parallel, so output and merged sections get
+// created in a nondeterministic order. Put them back in the order of
+// first appearance on the command line to keep the output reproducible.
+func RestoreSectionCreationOrder(ctx *Context) {
+	osecs := make([]*OutputSection, 0, len(ctx.OutputSections))
+	msecs := make([]*MergedSection, 0, len(ctx.MergedSections))
+	seenOsecs := make(map[*OutputSection]bool)
+	seenMsecs := make(map[*MergedSection]bool)
+
 	for _, file := range ctx.Objs {
-		file.ResolveSymbols()
+		for _, isec := range file.Sections {
+			if isec != nil && !seenOsecs[isec.OutputSection] {
+				seenOsecs[isec.OutputSection] = true
+				osecs = append(osecs, isec.OutputSection)
+			}
+		}
+
+		for _, m := range file.MergeableSections {
+			if m != nil && !seenMsecs[m.Parent] {
+				seenMsecs[m.Parent] = true
+				msecs = append(msecs, m.Parent)
+			}
+		}
+	}
+
+	assert(len(osecs) == len(ctx.OutputSections))
+	assert(len(msecs) == len(ctx.MergedSections))
+
+	for i, osec := range osecs {
+		osec.Idx = uint32(i)
 	}
 
+	ctx.OutputSections = osecs
+	ctx.MergedSections = msecs
+}
+
+func ResolveSymbols(ctx *Context) {
+	ctx.ParallelFor(len(ctx.Objs), func(i int) {
+		ctx.Objs[i].ResolveSymbols(ctx)
+	})
+
 	MarkLiveObjects(ctx)
 
 	for _, file := range ctx.Objs {
@@ -23,6 +62,76 @@ func ResolveSymbols(ctx *Context) {
 	ctx.Objs = utils.RemoveIf[*ObjectFile](ctx.Objs, func(file *ObjectFile) bool {
 		return !file.IsAlive
 	})
+	flushTraceLogs(ctx)
+
+	for _, file := range ctx.Objs {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			sym.Visibility = mergeVisibility(sym.Visibility,
+				file.ElfSyms[i].Visibility())
+		}
+	}
+
+	EliminateDuplicateComdatGroups(ctx)
+	traceResolutions(ctx)
+}
+
+func EliminateDuplicateComdatGroups(ctx *Context) {
+	for _, file := range ctx.Objs {
+		for _, ref := range file.ComdatGroups {
+			if ref.Group.Owner == nil {
+				ref.Group.Owner = file
+			}
+		}
+	}
+
+	cleared := make(map[*Symbol]bool)
+	for _, file := range ctx.Objs {
+		for _, sym := range file.EliminateDuplicateComdatGroups() {
+			cleared[sym] = true
+		}
+	}
+
+	// Symbols that were defined in a discarded group are now
+	// unresolved; give the surviving copies a chance to claim them.
+	if len(cleared) == 0 {
+		return
+	}
+
+	for _, file := range ctx.Objs {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			if cleared[file.Symbols[i]] {
+				file.ResolveSymbol(ctx, i)
+			}
+		}
+
+		// These definitions were traced the first time round.
+		file.traceLog = nil
+	}
+}
+
+// flushTraceLogs prints what was traced in the files that are part of
+// the link, in command line order. Archive members that weren't pulled
+// in have been removed by now, and so is their output.
+func flushTraceLogs(ctx *Context) {
+	for _, file := range ctx.Objs {
+		for _, line := range file.traceLog {
+			ctx.Tracef("%s", line)
+		}
+		file.traceLog = nil
+	}
+}
+
+func traceResolutions(ctx *Context) {
+	for _, name := range ctx.Args.TraceSymbols {
+		sym, ok := ctx.SymbolMap.Get(name)
+		if !ok || sym.File == nil {
+			ctx.Tracef("%s: unresolved", name)
+			continue
+		}
+		ctx.Tracef("%s: resolved to definition in %s",
+			name, sym.File.File.DisplayName())
+	}
 }
 
 func MarkLiveObjects(ctx *Context) {
@@ -33,7 +142,9 @@ func MarkLiveObjects(ctx *Context) {
 		}
 	}
 
-	utils.Assert(len(roots) > 0)
+	if len(roots) == 0 {
+		fatal("no input files")
+	}
 
 	for len(roots) > 0 {
 		file := roots[0]
@@ -41,7 +152,7 @@ func MarkLiveObjects(ctx *Context) {
 			continue
 		}
 
-		file.MarkLiveObjects(func(file *ObjectFile) {
+		file.MarkLiveObjects(ctx, func(file *ObjectFile) {
 			roots = append(roots, file)
 		})
 
@@ -49,10 +160,103 @@ func MarkLiveObjects(ctx *Context) {
 	}
 }
 
-func RegisterSectionPieces(ctx *Context) {
-	for _, file := range ctx.Objs {
-		file.RegisterSectionPieces()
+func incompatibleFiles(a, b *ObjectFile, what, x, y string) {
+	fail(&LinkError{
+		File: a.File.DisplayName(),
+		Err: fmt.Errorf("%s %s is incompatible with %s of %s",
+			what, x, y, b.File.DisplayName()),
+	})
+}
+
+func MergeRiscvAttributes(ctx *Context) *RiscvAttributes {
+	var merged *RiscvAttributes
+	var isa *Isa
+	var isaFile, stackAlignFile, privSpecFile *ObjectFile
+
+	for _, obj := range ctx.Objs {
+		attrs := obj.RiscvAttributes
+		if attrs == nil {
+			continue
+		}
+
+		if merged == nil {
+			merged = &RiscvAttributes{}
+		}
+
+		if attrs.Arch != "" {
+			cur, err := ParseIsa(attrs.Arch)
+			if err != nil {
+				fail(&LinkError{File: obj.File.DisplayName(),
+					Section: ".riscv.attributes", Err: err})
+			}
+
+			if isa == nil {
+				isa, isaFile = cur, obj
+			} else {
+				if cur.Xlen != isa.Xlen {
+					incompatibleFiles(obj, isaFile, "XLEN",
+						strconv.Itoa(cur.Xlen), strconv.Itoa(isa.Xlen))
+				}
+				if cur.Base != isa.Base {
+					incompatibleFiles(obj, isaFile, "base ISA",
+						"RV"+strings.ToUpper(cur.Base),
+						"RV"+strings.ToUpper(isa.Base))
+				}
+				isa.Merge(cur)
+			}
+		}
+
+		if attrs.StackAlign != 0 {
+			if merged.StackAlign == 0 {
+				merged.StackAlign, stackAlignFile = attrs.StackAlign, obj
+			} else if merged.StackAlign != attrs.StackAlign {
+				incompatibleFiles(obj, stackAlignFile, "stack alignment",
+					strconv.FormatUint(attrs.StackAlign, 10),
+					strconv.FormatUint(merged.StackAlign, 10))
+			}
+		}
+
+		merged.UnalignedAccess = merged.UnalignedAccess || attrs.UnalignedAccess
+
+		if attrs.HasPrivSpec {
+			if !merged.HasPrivSpec {
+				merged.PrivSpec, merged.HasPrivSpec = attrs.PrivSpec, true
+				privSpecFile = obj
+			} else if merged.PrivSpec != attrs.PrivSpec {
+				ctx.Warn(&LinkError{
+					File: obj.File.DisplayName(),
+					Err: fmt.Errorf("privileged spec version %d.%d.%d differs "+
+						"from %d.%d.%d of %s", attrs.PrivSpec[0],
+						attrs.PrivSpec[1], attrs.PrivSpec[2], merged.PrivSpec[0],
+						merged.PrivSpec[1], merged.PrivSpec[2],
+						privSpecFile.File.DisplayName()),
+				})
+				if privSpecLess(merged.PrivSpec, attrs.PrivSpec) {
+					merged.PrivSpec, privSpecFile = attrs.PrivSpec, obj
+				}
+			}
+		}
+	}
+
+	if isa != nil {
+		merged.Arch = isa.String()
+	}
+	return merged
+}
+
+func privSpecLess(a, b [3]uint64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
 	}
+	return false
+}
+
+func RegisterSectionPieces(ctx *Context) {
+	ctx.ParallelFor(len(ctx.Objs), func(i int) {
+		ctx.Objs[i].RegisterSectionPieces()
+	})
 }
 
 func CreateSyntheticSections(ctx *Context) {
@@ -62,44 +266,177 @@ func CreateSyntheticSections(ctx *Context) {
 	}
 
 	ctx.Ehdr = push(NewOutputEhdr()).(*OutputEhdr)
-	ctx.Phdr = push(NewOutputPhdr()).(*OutputPhdr)
+	if !ctx.Args.Relocatable {
+		ctx.Phdr = push(NewOutputPhdr()).(*OutputPhdr)
+		ctx.Phdr.ExecStack = needsExecStack(ctx)
+	}
 	ctx.Shdr = push(NewOutputShdr()).(*OutputShdr)
+	ctx.ShStrtab = push(NewStrtabSection(".shstrtab")).(*StrtabSection)
 	ctx.Got = push(NewGotSection()).(*GotSection)
+
+	if ctx.Args.BuildId.Kind != BuildIdKindNone && !ctx.Args.Relocatable {
+		ctx.BuildId = push(NewBuildIdSection()).(*BuildIdSection)
+	}
+
+	if ctx.Args.GdbIndex {
+		ctx.GdbIndex = push(NewGdbIndexSection()).(*GdbIndexSection)
+	}
+
+	if ctx.Args.Relocatable || ctx.Args.EmitRelocs {
+		ctx.Symtab = push(NewSymtabSection()).(*SymtabSection)
+		ctx.Strtab = push(NewStrtabSection(".strtab")).(*StrtabSection)
+	}
+
+	if !ctx.Args.Relocatable && (ctx.Args.ExportDynamic || ctx.DynamicList != nil) {
+		ctx.Dynsym = push(NewDynsymSection()).(*DynsymSection)
+		ctx.Dynstr = push(NewStrtabSection(".dynstr")).(*StrtabSection)
+		ctx.Dynstr.Shdr.Flags = uint64(elf.SHF_ALLOC)
+		ctx.Hash = push(NewHashSection()).(*HashSection)
+		if ctx.VersionScript != nil && ctx.VersionScript.HasVersions() {
+			ctx.Versym = push(NewVersymSection()).(*VersymSection)
+			ctx.Verdef = push(NewVerdefSection()).(*VerdefSection)
+		}
+		ctx.Dynamic = push(NewDynamicSection()).(*DynamicSection)
+	}
+
+	if attrs := MergeRiscvAttributes(ctx); attrs != nil {
+		ctx.RiscvAttributes = push(
+			NewRiscvAttributesSection(attrs.Encode())).(*RiscvAttributesSection)
+	}
 }
 
-func SetOutputSectionOffsets(ctx *Context) uint64 {
-	addr := IMAGE_BASE
+// CreateRelocatableSections adds the relocation sections of a partial
+// link or of --emit-relocs, and the section groups of a partial link.
+func CreateRelocatableSections(ctx *Context) {
+	relocs := make(map[*OutputSection]*RelocSection)
+	for _, osec := range ctx.OutputSections {
+		if len(osec.Members) > 0 && hasRelocations(osec) {
+			relocs[osec] = NewRelocSection(ctx, osec)
+			ctx.Chunks = append(ctx.Chunks, relocs[osec])
+		}
+	}
+
+	if !ctx.Args.Relocatable {
+		return
+	}
+
+	for _, file := range ctx.Objs {
+		for _, ref := range file.ComdatGroups {
+			if ref.Group.Owner == file {
+				ctx.Chunks = append(ctx.Chunks,
+					NewComdatGroupSection(ctx, file, ref, relocs))
+			}
+		}
+	}
+}
+
+// ComputeSectionHeaders numbers the chunks that get a section header,
+// names them and builds the symbol tables. .symtab refers to sections
+// by their indices, and the dynamic symbol table has to be complete
+// before section sizes are computed.
+func ComputeSectionHeaders(ctx *Context) {
+	shndx := int64(1)
 	for _, chunk := range ctx.Chunks {
-		if chunk.GetShdr().Flags&uint64(elf.SHF_ALLOC) == 0 {
+		if chunk == Chunker(ctx.Ehdr) || chunk == Chunker(ctx.Shdr) ||
+			chunk == Chunker(ctx.Phdr) {
 			continue
 		}
 
-		addr = utils.AlignTo(addr, chunk.GetShdr().AddrAlign)
-		chunk.GetShdr().Addr = addr
-
-		if !isTbss(chunk) {
-			addr += chunk.GetShdr().Size
+		if chunk == Chunker(ctx.Got) && ctx.Got.Shdr.Size == 0 {
+			continue
 		}
+
+		chunk.SetShndx(shndx)
+		shndx++
+		chunk.GetShdr().Name = ctx.ShStrtab.AddString(chunk.GetName())
+	}
+
+	if ctx.Symtab != nil {
+		ctx.Symtab.Build(ctx)
 	}
 
-	i := 0
-	first := ctx.Chunks[0]
-	for {
-		shdr := ctx.Chunks[i].GetShdr()
-		shdr.Offset = shdr.Addr - first.GetShdr().Addr
-		i++
+	if ctx.Verdef != nil {
+		ctx.Verdef.Build(ctx)
+	}
 
-		if i >= len(ctx.Chunks) ||
-			ctx.Chunks[i].GetShdr().Flags&uint64(elf.SHF_ALLOC) == 0 {
-			break
+	if ctx.Dynsym != nil {
+		ctx.Dynsym.Build(ctx)
+	}
+}
+
+func SetOutputSectionOffsets(ctx *Context) uint64 {
+	if ctx.Args.Relocatable {
+		fileoff := uint64(0)
+		for _, chunk := range ctx.Chunks {
+			shdr := chunk.GetShdr()
+			fileoff = utils.AlignTo(fileoff, shdr.AddrAlign)
+			shdr.Offset = fileoff
+			if shdr.Type != uint32(elf.SHT_NOBITS) {
+				fileoff += shdr.Size
+			}
 		}
+		return fileoff
 	}
 
-	lastShdr := ctx.Chunks[i-1].GetShdr()
-	fileoff := lastShdr.Offset + lastShdr.Size
+	// A segment's file offset and address must be congruent modulo the
+	// page size for the kernel to mmap it, so both advance together
+	// within a segment. A new segment starts on a fresh page at the
+	// same page offset the file is at; the file itself is only padded
+	// for -z separate-code and the end of RELRO. NOBITS sections take
+	// no file space, so the next segment's contents overlap them.
+	maxPage := ctx.MaxPageSize()
+	commonPage := ctx.CommonPageSize()
+	addr := ctx.Target.ImageBase()
+	fileoff := uint64(0)
+	var prev Chunker
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		if shdr.Flags&uint64(elf.SHF_ALLOC) == 0 {
+			continue
+		}
+
+		if prev != nil {
+			switch {
+			case ctx.Args.ZSeparateCode && isExec(prev) != isExec(chunk):
+				addr = utils.AlignTo(addr, maxPage)
+				fileoff = utils.AlignTo(fileoff, maxPage)
+			case startsNewSegment(prev, chunk):
+				if addr%maxPage != 0 || fileoff%maxPage != 0 {
+					addr = utils.AlignTo(addr, maxPage) + fileoff%maxPage
+				}
+			case isRelro(ctx, prev) && !isRelro(ctx, chunk):
+				fileoff += utils.AlignTo(addr, commonPage) - addr
+				addr = utils.AlignTo(addr, commonPage)
+			}
+		}
+		prev = chunk
+
+		// .tbss takes no address space; the chunks after it reuse it.
+		if isTbss(chunk) {
+			shdr.Addr = utils.AlignTo(addr, shdr.AddrAlign)
+			shdr.Offset = fileoff
+			continue
+		}
+
+		aligned := utils.AlignTo(addr, shdr.AddrAlign)
+		if shdr.Type != uint32(elf.SHT_NOBITS) {
+			fileoff += aligned - addr
+		}
+		addr = aligned
+
+		shdr.Addr = addr
+		shdr.Offset = fileoff
+		addr += shdr.Size
+		if shdr.Type != uint32(elf.SHT_NOBITS) {
+			fileoff += shdr.Size
+		}
+	}
 
-	for ; i < len(ctx.Chunks); i++ {
-		shdr := ctx.Chunks[i].GetShdr()
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		if shdr.Flags&uint64(elf.SHF_ALLOC) != 0 {
+			continue
+		}
 		fileoff = utils.AlignTo(fileoff, shdr.AddrAlign)
 		shdr.Offset = fileoff
 		fileoff += shdr.Size
@@ -109,6 +446,26 @@ func SetOutputSectionOffsets(ctx *Context) uint64 {
 	return fileoff
 }
 
+// CompressDebugSections swaps each debug section for a compressed copy.
+// The copies are rendered here rather than in CopyChunks, so this has
+// to run once addresses are final, and file offsets have to be
+// computed again afterwards.
+func CompressDebugSections(ctx *Context) {
+	ctx.ParallelFor(len(ctx.Chunks), func(i int) {
+		chunk, ok := ctx.Chunks[i].(ChunkWriter)
+		if !ok {
+			return
+		}
+
+		shdr := chunk.GetShdr()
+		if shdr.Flags&uint64(elf.SHF_ALLOC) == 0 &&
+			shdr.Type != uint32(elf.SHT_NOBITS) && shdr.Size > 0 &&
+			strings.HasPrefix(chunk.GetName(), ".debug") {
+			ctx.Chunks[i] = NewCompressedSection(ctx, chunk)
+		}
+	})
+}
+
 func BinSections(ctx *Context) {
 	group := make([][]*InputSection, len(ctx.OutputSections))
 	for _, file := range ctx.Objs {
@@ -127,6 +484,51 @@ func BinSections(ctx *Context) {
 	}
 }
 
+// SortInputSections puts the members of each output section in their
+// final order. Constructor and destructor tables are sorted by init
+// priority; other sections by the ordering files, then by --sort-section.
+// Sections that compare equal keep their input order.
+func SortInputSections(ctx *Context) {
+	ranks := make(map[*InputSection]int)
+	if ctx.Args.SymbolOrderingFile != "" || ctx.Args.SectionOrderingFile != "" {
+		ranks = computeSectionRanks(ctx)
+	}
+
+	rank := func(isec *InputSection) int {
+		if r, ok := ranks[isec]; ok {
+			return r
+		}
+		return math.MaxInt
+	}
+
+	ctx.ParallelFor(len(ctx.OutputSections), func(i int) {
+		osec := ctx.OutputSections[i]
+		members := osec.Members
+
+		if isInitArrayOutput(osec) {
+			sort.SliceStable(members, func(a, b int) bool {
+				return getInitPriority(members[a]) < getInitPriority(members[b])
+			})
+			return
+		}
+
+		sort.SliceStable(members, func(a, b int) bool {
+			x, y := members[a], members[b]
+			if rank(x) != rank(y) {
+				return rank(x) < rank(y)
+			}
+
+			switch ctx.Args.SortSection {
+			case SortSectionName:
+				return x.Name() < y.Name()
+			case SortSectionAlignment:
+				return x.P2Align > y.P2Align
+			}
+			return false
+		})
+	})
+}
+
 func CollectOutputSections(ctx *Context) []Chunker {
 	osecs := make([]Chunker, 0)
 	for _, osec := range ctx.OutputSections {
@@ -158,14 +560,31 @@ func ComputeSectionSizes(ctx *Context) {
 
 		osec.Shdr.Size = offset
 		osec.Shdr.AddrAlign = 1 << p2align
+		osec.Shdr.EntSize = getEntSize(osec.Members)
 	}
 }
 
+func getEntSize(members []*InputSection) uint64 {
+	if len(members) == 0 {
+		return 0
+	}
+	entsize := members[0].Shdr().EntSize
+	for _, isec := range members[1:] {
+		if isec.Shdr().EntSize != entsize {
+			return 0
+		}
+	}
+	return entsize
+}
+
 func SortOutputSections(ctx *Context) {
 	rank := func(chunk Chunker) int32 {
 		typ := chunk.GetShdr().Type
 		flags := chunk.GetShdr().Flags
 
+		if typ == uint32(elf.SHT_GROUP) {
+			return 1
+		}
 		if flags&uint64(elf.SHF_ALLOC) == 0 {
 			return math.MaxInt32 - 1
 		}
@@ -192,9 +611,11 @@ func SortOutputSections(ctx *Context) {
 		writeable := b2i(flags&uint64(elf.SHF_WRITE) != 0)
 		notExec := b2i(flags&uint64(elf.SHF_EXECINSTR) == 0)
 		notTls := b2i(flags&uint64(elf.SHF_TLS) == 0)
+		notRelro := b2i(!isRelro(ctx, chunk))
 		isBss := b2i(typ == uint32(elf.SHT_NOBITS))
 
-		return int32(writeable<<7 | notExec<<6 | notTls<<5 | isBss<<4)
+		return int32(writeable<<7 | notExec<<6 | notTls<<5 | notRelro<<4 |
+			isBss<<3)
 	}
 
 	sort.SliceStable(ctx.Chunks, func(i, j int) bool {
@@ -203,15 +624,15 @@ func SortOutputSections(ctx *Context) {
 }
 
 func ComputeMergedSectionSizes(ctx *Context) {
-	for _, osec := range ctx.MergedSections {
-		osec.AssignOffsets()
-	}
+	ctx.ParallelFor(len(ctx.MergedSections), func(i int) {
+		ctx.MergedSections[i].AssignOffsets()
+	})
 }
 
 func ScanRelocations(ctx *Context) {
-	for _, file := range ctx.Objs {
-		file.ScanRelocations()
-	}
+	ctx.ParallelFor(len(ctx.Objs), func(i int) {
+		ctx.Objs[i].ScanRelocations(ctx)
+	})
 
 	syms := make([]*Symbol, 0)
 	for _, file := range ctx.Objs {
@@ -223,16 +644,87 @@ func ScanRelocations(ctx *Context) {
 	}
 
 	for _, sym := range syms {
+		if sym.Flags&NeedsGot != 0 {
+			ctx.Got.AddGotSymbol(ctx, sym)
+		}
+
 		if sym.Flags&NeedsGotTp != 0 {
-			ctx.Got.AddGotTpSymbol(sym)
+			ctx.Got.AddGotTpSymbol(ctx, sym)
 		}
 
 		sym.Flags = 0
 	}
 }
 
+// isRelro reports whether chunk belongs in the RELRO segment, which the
+// loader makes read-only once relocations have been applied.
+func isRelro(ctx *Context, chunk Chunker) bool {
+	if !ctx.Args.ZRelro {
+		return false
+	}
+
+	shdr := chunk.GetShdr()
+	if shdr.Flags&uint64(elf.SHF_WRITE) == 0 {
+		return false
+	}
+	if shdr.Flags&uint64(elf.SHF_TLS) != 0 || chunk == Chunker(ctx.Got) ||
+		chunk == Chunker(ctx.Dynamic) {
+		return true
+	}
+
+	switch elf.SectionType(shdr.Type) {
+	case elf.SHT_INIT_ARRAY, elf.SHT_FINI_ARRAY, elf.SHT_PREINIT_ARRAY:
+		return true
+	}
+
+	switch chunk.GetName() {
+	case ".data.rel.ro", ".ctors", ".dtors":
+		return true
+	}
+	return false
+}
+
+func isExec(chunk Chunker) bool {
+	return chunk.GetShdr().Flags&uint64(elf.SHF_EXECINSTR) != 0
+}
+
+// startsNewSegment reports whether createPhdr puts chunk in a PT_LOAD
+// of its own rather than the one holding prev.
+func startsNewSegment(prev, chunk Chunker) bool {
+	if toPhdrFlags(prev) != toPhdrFlags(chunk) {
+		return true
+	}
+	return isBss(prev) && !isBss(chunk)
+}
+
 func isTbss(chunk Chunker) bool {
 	shdr := chunk.GetShdr()
 	return shdr.Type == uint32(elf.SHT_NOBITS) &&
 		shdr.Flags&uint64(elf.SHF_TLS) != 0
 }
+
+// CopyChunks writes every chunk into the output. The members of an
+// output section are copied as separate jobs, so that a single large
+// section is still spread across threads without nesting ParallelFor,
+// which would run more goroutines than --threads allows.
+func CopyChunks(ctx *Context) {
+	jobs := make([]func(), 0, len(ctx.Chunks))
+	for _, chunk := range ctx.Chunks {
+		chunk := chunk
+		osec, ok := chunk.(*OutputSection)
+		if !ok || osec.Shdr.Type == uint32(elf.SHT_NOBITS) {
+			jobs = append(jobs, func() { chunk.CopyBuf(ctx) })
+			continue
+		}
+
+		buf := ctx.Buf[osec.Shdr.Offset:]
+		for _, isec := range osec.Members {
+			isec := isec
+			jobs = append(jobs, func() { isec.WriteTo(ctx, buf[isec.Offset:]) })
+		}
+	}
+
+	ctx.ParallelFor(len(jobs), func(i int) {
+		jobs[i]()
+	})
+}
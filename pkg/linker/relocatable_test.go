@@ -0,0 +1,174 @@
+package linker_test
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"github.com/ksco/rvld/pkg/linker"
+	"os"
+	"testing"
+)
+
+// riscv64-partial.o is built with relaxation, so its code has an
+// R_RISCV_ALIGN, and its %pcrel_lo refers to a local label at the
+// auipc. It also has a COMDAT group and .riscv.attributes. A partial
+// link with riscv64.o has to keep all of these for the final link.
+func TestRelocatable(t *testing.T) {
+	args := linker.NewContextArgs()
+	args.Relocatable = true
+	partial := &bufferAt{}
+	_, err := linker.Link(context.Background(), linker.Config{
+		Args: args,
+		Inputs: []linker.Input{
+			{Name: "riscv64.o"}, {Name: "riscv64-partial.o"},
+		},
+		FS:     os.DirFS("testdata"),
+		Output: partial,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(partial.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != elf.ET_REL || f.Machine != elf.EM_RISCV {
+		t.Fatalf("got a %v %v file, want a RISC-V relocatable", f.Machine, f.Type)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := f.Section(".text")
+	rela := f.Section(".rela.text")
+	if text == nil || rela == nil {
+		t.Fatal(".text or .rela.text is missing")
+	}
+	relocs, err := rela.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hi20 := make(map[uint64]bool)
+	for i := 0; i+24 <= len(relocs); i += 24 {
+		info := binary.LittleEndian.Uint64(relocs[i+8:])
+		if elf.R_RISCV(elf.R_TYPE64(info)) == elf.R_RISCV_PCREL_HI20 {
+			hi20[binary.LittleEndian.Uint64(relocs[i:])] = true
+		}
+	}
+
+	numLo12, numAlign := 0, 0
+	for i := 0; i+24 <= len(relocs); i += 24 {
+		offset := binary.LittleEndian.Uint64(relocs[i:])
+		info := binary.LittleEndian.Uint64(relocs[i+8:])
+		addend := binary.LittleEndian.Uint64(relocs[i+16:])
+
+		switch elf.R_RISCV(elf.R_TYPE64(info)) {
+		case elf.R_RISCV_PCREL_LO12_I:
+			// The symbol must still mark the auipc with the HI20.
+			numLo12++
+			sym := syms[elf.R_SYM64(info)-1]
+			if int(sym.Section) >= len(f.Sections) ||
+				f.Sections[sym.Section] != text || !hi20[sym.Value] {
+				t.Errorf("PCREL_LO12_I at 0x%x refers to %s at 0x%x, "+
+					"which has no PCREL_HI20", offset, sym.Name, sym.Value)
+			}
+		case elf.R_RISCV_ALIGN:
+			// The padding must still end on the alignment boundary.
+			numAlign++
+			if (offset+addend)%16 != 0 {
+				t.Errorf("ALIGN at 0x%x with 0x%x bytes of padding "+
+					"doesn't end on a 16-byte boundary", offset, addend)
+			}
+		}
+	}
+	if numLo12 != 1 || numAlign != 1 {
+		t.Errorf("got %d PCREL_LO12_I and %d ALIGN relocations, want one each",
+			numLo12, numAlign)
+	}
+
+	var group *elf.Section
+	for _, sec := range f.Sections {
+		if sec.Type == elf.SHT_GROUP {
+			group = sec
+		}
+	}
+	if group == nil {
+		t.Fatal("the COMDAT group is missing")
+	}
+	members, err := group.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 8 || binary.LittleEndian.Uint32(members) != 1 ||
+		syms[group.Info-1].Name != "inline" ||
+		f.Sections[binary.LittleEndian.Uint32(members[4:])].Name != ".text.inline" {
+		t.Errorf("got group %s with members %x, want .text.inline in COMDAT inline",
+			syms[group.Info-1].Name, members)
+	}
+
+	checkAttributes := func(f *elf.File) {
+		sec := f.Section(".riscv.attributes")
+		if sec == nil || sec.Type != elf.SectionType(0x70000003) {
+			t.Fatal(".riscv.attributes is missing")
+		}
+		contents, err := sec.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(contents, []byte("rv64i2p0_m2p0\x00")) {
+			t.Errorf(".riscv.attributes lost the arch: %q", contents)
+		}
+	}
+	checkAttributes(f)
+
+	// Link the result again, and check that load still finds value.
+	out, _, err := link(linker.Config{
+		Inputs: []linker.Input{{
+			Name:   "partial.o",
+			Reader: bytes.NewReader(partial.buf),
+			Size:   int64(len(partial.buf)),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := elf.NewFile(bytes.NewReader(out.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAttributes(exe)
+
+	// The executable has no symbol table, but .text and .data of the
+	// partial link come first in the sections of the same name, so
+	// symbols keep their offsets.
+	addrs := make(map[string]uint64)
+	for _, sym := range syms {
+		if int(sym.Section) < len(f.Sections) {
+			if sec := exe.Section(f.Sections[sym.Section].Name); sec != nil {
+				addrs[sym.Name] = sec.Addr + sym.Value
+			}
+		}
+	}
+
+	text = exe.Section(".text")
+	code, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insn := func(addr uint64) uint32 {
+		return binary.LittleEndian.Uint32(code[addr-text.Addr:])
+	}
+
+	load := addrs["load"]
+	auipc, ld := insn(load), insn(load+4)
+	got := load + uint64(signExtend(auipc&0xfffff000, 32)+signExtend(ld>>20, 12))
+	if got != addrs["value"] {
+		t.Errorf("load reads 0x%x, want value at 0x%x", got, addrs["value"])
+	}
+}
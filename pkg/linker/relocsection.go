@@ -0,0 +1,99 @@
+package linker
+
+import (
+	"debug/elf"
+	"math"
+)
+
+// RelocSection re-emits the relocations of an output section's members
+// against the output symbol table.
+type RelocSection struct {
+	Chunk
+	OutputSection *OutputSection
+}
+
+func NewRelocSection(ctx *Context, osec *OutputSection) *RelocSection {
+	r := &RelocSection{Chunk: NewChunk(), OutputSection: osec}
+	r.Name = ".rela" + osec.Name
+	r.Shdr.Type = uint32(elf.SHT_RELA)
+	r.Shdr.Flags = uint64(elf.SHF_INFO_LINK) |
+		osec.Shdr.Flags&uint64(elf.SHF_GROUP)
+	r.Shdr.AddrAlign = ctx.WordSize()
+	r.Shdr.EntSize = uint64(GetRelaSize(ctx.Class()))
+
+	for _, isec := range osec.Members {
+		r.Shdr.Size += uint64(len(isec.GetRels())) * r.Shdr.EntSize
+	}
+	return r
+}
+
+func hasRelocations(osec *OutputSection) bool {
+	for _, isec := range osec.Members {
+		if isec.RelsecIdx != math.MaxUint32 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RelocSection) UpdateShdr(ctx *Context) {
+	r.Shdr.Link = uint32(ctx.Symtab.Shndx)
+	r.Shdr.Info = uint32(r.OutputSection.Shndx)
+}
+
+// Relocations against a section symbol are rewritten against the
+// section symbol of the output section, with the member's offset
+// folded into the addend. A mergeable section no longer exists as a
+// whole, so the addend picks the fragment it points into. Symbols that
+// were dropped along with their section become symbol 0.
+func (r *RelocSection) translate(ctx *Context, isec *InputSection, rel Rela) Rela {
+	offset := rel.Offset
+	if isec.Reverse {
+		offset = uint64(isec.ShSize) - offset - ctx.WordSize()
+	}
+
+	out := Rela{
+		Offset: isec.GetAddr() + offset,
+		Type:   rel.Type,
+		Addend: rel.Addend,
+	}
+
+	if rel.Sym == 0 {
+		return out
+	}
+
+	file := isec.File
+	esym := &file.ElfSyms[rel.Sym]
+	if esym.Type() == uint8(elf.STT_SECTION) {
+		target := file.GetSection(esym, int(rel.Sym))
+		if target != nil && target.IsAlive {
+			out.Sym = ctx.Symtab.SectionSyms[target.OutputSection]
+			out.Addend += int64(target.Offset)
+			return out
+		}
+
+		shndx := file.GetShndx(esym, int(rel.Sym))
+		if m := file.MergeableSections[shndx]; m != nil {
+			frag, fragOffset := m.GetFragment(uint32(rel.Addend))
+			if frag != nil {
+				out.Sym = ctx.Symtab.SectionSyms[frag.OutputSection]
+				out.Addend = int64(frag.Offset) + int64(fragOffset)
+			}
+		}
+		return out
+	}
+
+	out.Sym = uint32(file.Symbols[rel.Sym].SymtabIdx)
+	return out
+}
+
+func (r *RelocSection) CopyBuf(ctx *Context) {
+	rels := make([]Rela, 0, r.Shdr.Size/r.Shdr.EntSize)
+	for _, isec := range r.OutputSection.Members {
+		for _, rel := range isec.GetRels() {
+			rels = append(rels, r.translate(ctx, isec, rel))
+		}
+	}
+
+	WriteRelas(ctx.Class(), ctx.Buf[r.Shdr.Offset:], rels)
+}
@@ -0,0 +1,351 @@
+package linker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TagRiscvWholeFile        = 1
+	TagRiscvStackAlign       = 4
+	TagRiscvArch             = 5
+	TagRiscvUnalignedAccess  = 6
+	TagRiscvPrivSpec         = 8
+	TagRiscvPrivSpecMinor    = 10
+	TagRiscvPrivSpecRevision = 12
+)
+
+type RiscvAttributes struct {
+	Arch            string
+	StackAlign      uint64
+	UnalignedAccess bool
+	PrivSpec        [3]uint64
+	HasPrivSpec     bool
+}
+
+func readUleb(data []byte) (uint64, []byte, error) {
+	val, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, errors.New("malformed ULEB128 value")
+	}
+	return val, data[n:], nil
+}
+
+func readNtbs(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end == -1 {
+		return "", nil, errors.New("string is not null terminated")
+	}
+	return string(data[:end]), data[end+1:], nil
+}
+
+func ParseRiscvAttributes(data []byte) (*RiscvAttributes, error) {
+	if len(data) == 0 || data[0] != 'A' {
+		return nil, errors.New("unknown attributes section format")
+	}
+	data = data[1:]
+
+	attrs := &RiscvAttributes{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("truncated attributes section")
+		}
+		size := binary.LittleEndian.Uint32(data)
+		if size < 4 || int(size) > len(data) {
+			return nil, errors.New("bad attributes subsection size")
+		}
+		sub := data[4:size]
+		data = data[size:]
+
+		vendor, sub, err := readNtbs(sub)
+		if err != nil {
+			return nil, err
+		}
+		if vendor != "riscv" {
+			continue
+		}
+
+		for len(sub) > 0 {
+			if len(sub) < 5 {
+				return nil, errors.New("truncated attributes subsection")
+			}
+			tag := sub[0]
+			size := binary.LittleEndian.Uint32(sub[1:])
+			if size < 5 || int(size) > len(sub) {
+				return nil, errors.New("bad attributes subsection size")
+			}
+			body := sub[5:size]
+			sub = sub[size:]
+
+			if tag != TagRiscvWholeFile {
+				continue
+			}
+			if err := attrs.parseTags(body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return attrs, nil
+}
+
+func (a *RiscvAttributes) parseTags(data []byte) error {
+	for len(data) > 0 {
+		tag, rest, err := readUleb(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		// Tags with an odd number carry a string, the others a number.
+		if tag%2 == 1 {
+			var val string
+			if val, data, err = readNtbs(data); err != nil {
+				return err
+			}
+			if tag == TagRiscvArch {
+				a.Arch = val
+			}
+			continue
+		}
+
+		var val uint64
+		if val, data, err = readUleb(data); err != nil {
+			return err
+		}
+
+		switch tag {
+		case TagRiscvStackAlign:
+			a.StackAlign = val
+		case TagRiscvUnalignedAccess:
+			a.UnalignedAccess = val != 0
+		case TagRiscvPrivSpec:
+			a.PrivSpec[0] = val
+			a.HasPrivSpec = true
+		case TagRiscvPrivSpecMinor:
+			a.PrivSpec[1] = val
+			a.HasPrivSpec = true
+		case TagRiscvPrivSpecRevision:
+			a.PrivSpec[2] = val
+			a.HasPrivSpec = true
+		}
+	}
+
+	return nil
+}
+
+func (a *RiscvAttributes) Encode() []byte {
+	attrs := &bytes.Buffer{}
+	uleb := func(val uint64) {
+		attrs.Write(binary.AppendUvarint(nil, val))
+	}
+
+	if a.StackAlign != 0 {
+		uleb(TagRiscvStackAlign)
+		uleb(a.StackAlign)
+	}
+	if a.Arch != "" {
+		uleb(TagRiscvArch)
+		attrs.WriteString(a.Arch)
+		attrs.WriteByte(0)
+	}
+	if a.UnalignedAccess {
+		uleb(TagRiscvUnalignedAccess)
+		uleb(1)
+	}
+	if a.HasPrivSpec {
+		uleb(TagRiscvPrivSpec)
+		uleb(a.PrivSpec[0])
+		uleb(TagRiscvPrivSpecMinor)
+		uleb(a.PrivSpec[1])
+		uleb(TagRiscvPrivSpecRevision)
+		uleb(a.PrivSpec[2])
+	}
+
+	vendor := "riscv\x00"
+	fileLen := 5 + attrs.Len()
+	subLen := 4 + len(vendor) + fileLen
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('A')
+	binary.Write(buf, binary.LittleEndian, uint32(subLen))
+	buf.WriteString(vendor)
+	buf.WriteByte(TagRiscvWholeFile)
+	binary.Write(buf, binary.LittleEndian, uint32(fileLen))
+	buf.Write(attrs.Bytes())
+	return buf.Bytes()
+}
+
+type IsaVersion struct {
+	Major uint64
+	Minor uint64
+}
+
+func (v IsaVersion) Less(o IsaVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+type Isa struct {
+	Xlen       int
+	Base       string
+	Extensions map[string]IsaVersion
+}
+
+var isaVersionRe = regexp.MustCompile(`^(\d+)(?:p(\d+))?`)
+var isaMultiRe = regexp.MustCompile(`^([a-z][a-z0-9]*?[a-z])(?:(\d+)(?:p(\d+))?)?$`)
+
+func parseIsaVersion(s string, def IsaVersion) (IsaVersion, string) {
+	m := isaVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return def, s
+	}
+
+	v := IsaVersion{}
+	v.Major, _ = strconv.ParseUint(m[1], 10, 64)
+	if m[2] != "" {
+		v.Minor, _ = strconv.ParseUint(m[2], 10, 64)
+	}
+	return v, s[len(m[0]):]
+}
+
+func ParseIsa(arch string) (*Isa, error) {
+	s := strings.ToLower(arch)
+	isa := &Isa{Extensions: make(map[string]IsaVersion)}
+
+	switch {
+	case strings.HasPrefix(s, "rv32"):
+		isa.Xlen = 32
+	case strings.HasPrefix(s, "rv64"):
+		isa.Xlen = 64
+	default:
+		return nil, fmt.Errorf("invalid ISA string: %s", arch)
+	}
+	s = s[4:]
+
+	if s == "" {
+		return nil, fmt.Errorf("invalid ISA string: %s", arch)
+	}
+
+	base := s[0]
+	s = s[1:]
+	switch base {
+	case 'i', 'e':
+		isa.Base = string(base)
+		isa.Extensions[isa.Base], s = parseIsaVersion(s, IsaVersion{2, 0})
+	case 'g':
+		isa.Base = "i"
+		var v IsaVersion
+		v, s = parseIsaVersion(s, IsaVersion{2, 0})
+		for _, ext := range []string{"i", "m", "a", "f", "d"} {
+			isa.Extensions[ext] = v
+		}
+		isa.Extensions["zicsr"] = IsaVersion{2, 0}
+		isa.Extensions["zifencei"] = IsaVersion{2, 0}
+	default:
+		return nil, fmt.Errorf("invalid ISA base in: %s", arch)
+	}
+
+	for len(s) > 0 {
+		if s[0] == '_' {
+			s = s[1:]
+			continue
+		}
+
+		c := s[0]
+		if c == 'z' || c == 's' || c == 'x' {
+			end := strings.IndexByte(s, '_')
+			if end == -1 {
+				end = len(s)
+			}
+
+			m := isaMultiRe.FindStringSubmatch(s[:end])
+			if m == nil {
+				return nil, fmt.Errorf("invalid extension in ISA string: %s", arch)
+			}
+
+			v := IsaVersion{1, 0}
+			if m[2] != "" {
+				v, _ = parseIsaVersion(s[len(m[1]):end], v)
+			}
+			isa.Extensions[m[1]] = v
+			s = s[end:]
+			continue
+		}
+
+		if c < 'a' || c > 'z' {
+			return nil, fmt.Errorf("invalid extension in ISA string: %s", arch)
+		}
+
+		var v IsaVersion
+		v, s = parseIsaVersion(s[1:], IsaVersion{2, 0})
+		isa.Extensions[string(c)] = v
+	}
+
+	return isa, nil
+}
+
+const isaSingleLetterOrder = "iemafdqlcbkjtpvnh"
+
+func isaExtensionRank(name string) (int, int) {
+	if len(name) == 1 {
+		return 0, strings.IndexByte(isaSingleLetterOrder, name[0])
+	}
+
+	switch name[0] {
+	case 'z':
+		// Standard Z extensions are ordered by the category letter
+		// that follows the 'z', then alphabetically.
+		pos := strings.IndexByte(isaSingleLetterOrder, name[1])
+		if pos == -1 {
+			pos = len(isaSingleLetterOrder)
+		}
+		return 1, pos
+	case 's':
+		return 2, 0
+	}
+	return 3, 0
+}
+
+func (isa *Isa) String() string {
+	names := make([]string, 0, len(isa.Extensions))
+	for name := range isa.Extensions {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		ci, pi := isaExtensionRank(names[i])
+		cj, pj := isaExtensionRank(names[j])
+		if ci != cj {
+			return ci < cj
+		}
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		v := isa.Extensions[name]
+		parts = append(parts, fmt.Sprintf("%s%dp%d", name, v.Major, v.Minor))
+	}
+
+	return fmt.Sprintf("rv%d%s", isa.Xlen, strings.Join(parts, "_"))
+}
+
+func (isa *Isa) Merge(other *Isa) {
+	for name, v := range other.Extensions {
+		if cur, ok := isa.Extensions[name]; !ok || cur.Less(v) {
+			isa.Extensions[name] = v
+		}
+	}
+}
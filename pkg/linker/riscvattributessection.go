@@ -0,0 +1,18 @@
+package linker
+
+type RiscvAttributesSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewRiscvAttributesSection(contents []byte) *RiscvAttributesSection {
+	r := &RiscvAttributesSection{Chunk: NewChunk(), Contents: contents}
+	r.Name = ".riscv.attributes"
+	r.Shdr.Type = SHT_RISCV_ATTRIBUTES
+	r.Shdr.Size = uint64(len(contents))
+	return r
+}
+
+func (r *RiscvAttributesSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[r.Shdr.Offset:], r.Contents)
+}
@@ -0,0 +1,379 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+)
+
+type RiscvTarget struct {
+	Xlen int
+}
+
+func init() {
+	RegisterTarget(&RiscvTarget{Xlen: 64})
+	RegisterTarget(&RiscvTarget{Xlen: 32})
+}
+
+func (t *RiscvTarget) MachineType() MachineType {
+	if t.Xlen == 32 {
+		return MachineTypeRISCV32
+	}
+	return MachineTypeRISCV64
+}
+
+func (t *RiscvTarget) Machine() elf.Machine {
+	return elf.EM_RISCV
+}
+
+func (t *RiscvTarget) Class() elf.Class {
+	if t.Xlen == 32 {
+		return elf.ELFCLASS32
+	}
+	return elf.ELFCLASS64
+}
+
+func (t *RiscvTarget) PageSize() uint64 {
+	return 4096
+}
+
+func (t *RiscvTarget) ImageBase() uint64 {
+	return 0x200000
+}
+
+func (t *RiscvTarget) GetTpAddr(tls *Phdr) uint64 {
+	return tls.VAddr
+}
+
+func floatAbiName(flags uint32) string {
+	switch flags & EF_RISCV_FLOAT_ABI {
+	case EF_RISCV_FLOAT_ABI_SINGLE:
+		return "single-float"
+	case EF_RISCV_FLOAT_ABI_DOUBLE:
+		return "double-float"
+	case EF_RISCV_FLOAT_ABI_QUAD:
+		return "quad-float"
+	}
+	return "soft-float"
+}
+
+// CheckFlags rejects links that mix objects built for different
+// floating-point ABIs or for RVE and RVI.
+func (t *RiscvTarget) CheckFlags(ctx *Context) {
+	if len(ctx.Objs) == 0 {
+		return
+	}
+
+	first := ctx.Objs[0]
+	flags := first.GetEhdr().Flags
+	for _, obj := range ctx.Objs[1:] {
+		f := obj.GetEhdr().Flags
+		if f&EF_RISCV_FLOAT_ABI != flags&EF_RISCV_FLOAT_ABI {
+			incompatibleFiles(obj, first, "float ABI",
+				floatAbiName(f), floatAbiName(flags))
+		}
+
+		if f&EF_RISCV_RVE != flags&EF_RISCV_RVE {
+			b2s := func(flags uint32) string {
+				if flags&EF_RISCV_RVE != 0 {
+					return "RVE"
+				}
+				return "RVI"
+			}
+			incompatibleFiles(obj, first, "base ISA", b2s(f), b2s(flags))
+		}
+	}
+}
+
+func (t *RiscvTarget) GetEhdrFlags(ctx *Context) uint32 {
+	assert(len(ctx.Objs) > 0)
+	flags := ctx.Objs[0].GetEhdr().Flags
+	for _, obj := range ctx.Objs[1:] {
+		if obj.GetEhdr().Flags&EF_RISCV_RVC != 0 {
+			flags |= EF_RISCV_RVC
+			break
+		}
+	}
+
+	return flags
+}
+
+// Calls through the PLT go straight to the callee in a static
+// executable, so there are no stubs.
+func (t *RiscvTarget) PltEntrySize() uint64 {
+	return 0
+}
+
+func (t *RiscvTarget) WritePltEntry(ctx *Context, buf []byte, sym *Symbol) {}
+
+func (t *RiscvTarget) ScanRelocations(ctx *Context, i *InputSection) {
+	for _, rel := range i.GetRels() {
+		sym := i.File.Symbols[rel.Sym]
+		if sym.File == nil {
+			continue
+		}
+
+		switch elf.R_RISCV(rel.Type) {
+		case elf.R_RISCV_GOT_HI20:
+			sym.AddFlags(NeedsGot)
+		case elf.R_RISCV_TLS_GOT_HI20:
+			sym.AddFlags(NeedsGotTp)
+		}
+	}
+}
+
+func (t *RiscvTarget) ApplyRelocAlloc(ctx *Context, i *InputSection, base []byte) {
+	rels := i.GetRels()
+
+	for a := 0; a < len(rels); a++ {
+		rel := rels[a]
+		if rel.Type == uint32(elf.R_RISCV_NONE) ||
+			rel.Type == uint32(elf.R_RISCV_RELAX) {
+			continue
+		}
+
+		sym := i.File.Symbols[rel.Sym]
+		loc := base[rel.Offset:]
+
+		if sym.File == nil {
+			continue
+		}
+
+		S := sym.GetAddr()
+		A := uint64(rel.Addend)
+		P := i.GetAddr() + rel.Offset
+
+		switch elf.R_RISCV(rel.Type) {
+		case elf.R_RISCV_32:
+			utils.Write[uint32](loc, uint32(S+A))
+		case elf.R_RISCV_64:
+			utils.Write[uint64](loc, S+A)
+		case elf.R_RISCV_BRANCH:
+			writeBtype(loc, uint32(S+A-P))
+		case elf.R_RISCV_JAL:
+			writeJtype(loc, uint32(S+A-P))
+		case elf.R_RISCV_CALL, elf.R_RISCV_CALL_PLT:
+			val := uint32(S + A - P)
+			writeUtype(loc, val)
+			writeItype(loc[4:], val)
+		case elf.R_RISCV_GOT_HI20:
+			utils.Write[uint32](loc, uint32(sym.GetGotAddr(ctx)+A-P))
+		case elf.R_RISCV_TLS_GOT_HI20:
+			utils.Write[uint32](loc, uint32(sym.GetGotTpAddr(ctx)+A-P))
+		case elf.R_RISCV_PCREL_HI20:
+			utils.Write[uint32](loc, uint32(S+A-P))
+		case elf.R_RISCV_HI20:
+			val := toXlen(ctx, S+A)
+			if utils.SignExtend(val, 31) != val {
+				i.fatal(rel.Offset, "relocation R_RISCV_HI20 out of range: "+
+					sym.Name)
+			}
+			writeUtype(loc, uint32(val))
+		case elf.R_RISCV_LO12_I, elf.R_RISCV_LO12_S:
+			val := toXlen(ctx, S+A)
+			if rel.Type == uint32(elf.R_RISCV_LO12_I) {
+				writeItype(loc, uint32(val))
+			} else {
+				writeStype(loc, uint32(val))
+			}
+
+			if utils.SignExtend(val, 11) == val {
+				setRs1(loc, 0)
+			}
+		case elf.R_RISCV_TPREL_LO12_I, elf.R_RISCV_TPREL_LO12_S:
+			val := toXlen(ctx, S+A-ctx.TpAddr)
+			if rel.Type == uint32(elf.R_RISCV_TPREL_LO12_I) {
+				writeItype(loc, uint32(val))
+			} else {
+				writeStype(loc, uint32(val))
+			}
+
+			if utils.SignExtend(val, 11) == val {
+				setRs1(loc, 4)
+			}
+		}
+	}
+
+	for a := 0; a < len(rels); a++ {
+		switch elf.R_RISCV(rels[a].Type) {
+		case elf.R_RISCV_PCREL_LO12_I, elf.R_RISCV_PCREL_LO12_S:
+			sym := i.File.Symbols[rels[a].Sym]
+			if sym.InputSection != i {
+				i.fatal(rels[a].Offset, "PCREL_LO12 does not refer to a label "+
+					"in the same section: "+sym.Name)
+			}
+			loc := base[rels[a].Offset:]
+			val := utils.Read[uint32](base[sym.Value:])
+
+			if rels[a].Type == uint32(elf.R_RISCV_PCREL_LO12_I) {
+				writeItype(loc, val)
+			} else {
+				writeStype(loc, val)
+			}
+		}
+	}
+
+	for a := 0; a < len(rels); a++ {
+		switch elf.R_RISCV(rels[a].Type) {
+		case elf.R_RISCV_PCREL_HI20, elf.R_RISCV_GOT_HI20,
+			elf.R_RISCV_TLS_GOT_HI20:
+			loc := base[rels[a].Offset:]
+			val := utils.Read[uint32](loc)
+			utils.Write[uint32](loc, utils.Read[uint32](i.Contents[rels[a].Offset:]))
+			writeUtype(loc, val)
+		}
+	}
+}
+
+func (t *RiscvTarget) ApplyRelocNonAlloc(ctx *Context, i *InputSection, base []byte) {
+	for _, rel := range i.GetRels() {
+		if rel.Type == uint32(elf.R_RISCV_NONE) {
+			continue
+		}
+
+		sym := i.File.Symbols[rel.Sym]
+		loc := base[rel.Offset:]
+		S, A, dead := i.getNonAllocTarget(rel)
+
+		val := func(v uint64) uint64 {
+			if dead {
+				return i.getTombstone()
+			}
+			return v
+		}
+
+		switch rel.Type {
+		case uint32(elf.R_RISCV_32):
+			utils.Write[uint32](loc, uint32(val(S+A)))
+		case uint32(elf.R_RISCV_64):
+			utils.Write[uint64](loc, val(S+A))
+		case uint32(elf.R_RISCV_ADD8):
+			loc[0] += uint8(S + A)
+		case uint32(elf.R_RISCV_ADD16):
+			utils.Write[uint16](loc, utils.Read[uint16](loc)+uint16(S+A))
+		case uint32(elf.R_RISCV_ADD32):
+			utils.Write[uint32](loc, utils.Read[uint32](loc)+uint32(S+A))
+		case uint32(elf.R_RISCV_ADD64):
+			utils.Write[uint64](loc, utils.Read[uint64](loc)+S+A)
+		case uint32(elf.R_RISCV_SUB8):
+			loc[0] -= uint8(S + A)
+		case uint32(elf.R_RISCV_SUB16):
+			utils.Write[uint16](loc, utils.Read[uint16](loc)-uint16(S+A))
+		case uint32(elf.R_RISCV_SUB32):
+			utils.Write[uint32](loc, utils.Read[uint32](loc)-uint32(S+A))
+		case uint32(elf.R_RISCV_SUB64):
+			utils.Write[uint64](loc, utils.Read[uint64](loc)-(S+A))
+		case uint32(elf.R_RISCV_SUB6):
+			loc[0] = loc[0]&0xc0 | (loc[0]-uint8(S+A))&0x3f
+		case uint32(elf.R_RISCV_SET6):
+			loc[0] = loc[0]&0xc0 | uint8(S+A)&0x3f
+		case uint32(elf.R_RISCV_SET8):
+			loc[0] = uint8(S + A)
+		case uint32(elf.R_RISCV_SET16):
+			utils.Write[uint16](loc, uint16(S+A))
+		case uint32(elf.R_RISCV_SET32):
+			utils.Write[uint32](loc, uint32(S+A))
+		case R_RISCV_SET_ULEB128:
+			overwriteUleb(loc, S+A)
+		case R_RISCV_SUB_ULEB128:
+			old, _, err := readUleb(loc)
+			if err != nil {
+				i.fatal(rel.Offset, err.Error())
+			}
+			overwriteUleb(loc, old-(S+A))
+		case uint32(elf.R_RISCV_TLS_DTPREL32):
+			utils.Write[uint32](loc, uint32(val(S+A-ctx.TlsBegin)))
+		case uint32(elf.R_RISCV_TLS_DTPREL64):
+			utils.Write[uint64](loc, val(S+A-ctx.TlsBegin))
+		default:
+			i.fatal(rel.Offset, "unsupported relocation "+
+				elf.R_RISCV(rel.Type).String()+": "+sym.Name)
+		}
+	}
+}
+
+// overwriteUleb stores val in the ULEB128 number at loc without
+// changing how many bytes it takes, dropping any bits that don't fit.
+func overwriteUleb(loc []byte, val uint64) {
+	for k := 0; ; k++ {
+		more := loc[k] & 0x80
+		loc[k] = uint8(val&0x7f) | more
+		val >>= 7
+		if more == 0 {
+			return
+		}
+	}
+}
+
+// toXlen wraps val to XLEN bits and sign-extends it back to 64 bits,
+// which is how an RV32 hart sees an address held in a register.
+func toXlen(ctx *Context, val uint64) uint64 {
+	if ctx.Is64() {
+		return val
+	}
+	return utils.SignExtend(uint64(uint32(val)), 31)
+}
+
+func itype(val uint32) uint32 {
+	return val << 20
+}
+
+func stype(val uint32) uint32 {
+	return utils.Bits(val, 11, 5)<<25 | utils.Bits(val, 4, 0)<<7
+}
+
+func btype(val uint32) uint32 {
+	return utils.Bit(val, 12)<<31 | utils.Bits(val, 10, 5)<<25 |
+		utils.Bits(val, 4, 1)<<8 | utils.Bit(val, 11)<<7
+}
+
+func utype(val uint32) uint32 {
+	return (val + 0x800) & 0xffff_f000
+}
+
+func jtype(val uint32) uint32 {
+	return utils.Bit(val, 20)<<31 | utils.Bits(val, 10, 1)<<21 |
+		utils.Bit(val, 11)<<20 | utils.Bits(val, 19, 12)<<12
+}
+
+func cbtype(val uint16) uint16 {
+	return utils.Bit(val, 8)<<12 | utils.Bit(val, 4)<<11 | utils.Bit(val, 3)<<10 |
+		utils.Bit(val, 7)<<6 | utils.Bit(val, 6)<<5 | utils.Bit(val, 2)<<4 |
+		utils.Bit(val, 1)<<3 | utils.Bit(val, 5)<<2
+}
+
+func cjtype(val uint16) uint16 {
+	return utils.Bit(val, 11)<<12 | utils.Bit(val, 4)<<11 | utils.Bit(val, 9)<<10 |
+		utils.Bit(val, 8)<<9 | utils.Bit(val, 10)<<8 | utils.Bit(val, 6)<<7 |
+		utils.Bit(val, 7)<<6 | utils.Bit(val, 3)<<5 | utils.Bit(val, 2)<<4 |
+		utils.Bit(val, 1)<<3 | utils.Bit(val, 5)<<2
+}
+
+func writeItype(loc []byte, val uint32) {
+	mask := uint32(0b000000_00000_11111_111_11111_1111111)
+	utils.Write[uint32](loc, (utils.Read[uint32](loc)&mask)|itype(val))
+}
+
+func writeStype(loc []byte, val uint32) {
+	mask := uint32(0b000000_11111_11111_111_00000_1111111)
+	utils.Write[uint32](loc, (utils.Read[uint32](loc)&mask)|stype(val))
+}
+
+func writeBtype(loc []byte, val uint32) {
+	mask := uint32(0b000000_11111_11111_111_00000_1111111)
+	utils.Write[uint32](loc, (utils.Read[uint32](loc)&mask)|btype(val))
+}
+
+func writeUtype(loc []byte, val uint32) {
+	mask := uint32(0b000000_00000_00000_000_11111_1111111)
+	utils.Write[uint32](loc, (utils.Read[uint32](loc)&mask)|utype(val))
+}
+
+func writeJtype(loc []byte, val uint32) {
+	mask := uint32(0b000000_00000_00000_000_11111_1111111)
+	utils.Write[uint32](loc, (utils.Read[uint32](loc)&mask)|jtype(val))
+}
+
+func setRs1(loc []byte, rs1 uint32) {
+	utils.Write[uint32](loc, utils.Read[uint32](loc)&0b1111111_11111_00000_111_11111_1111111)
+	utils.Write[uint32](loc, utils.Read[uint32](loc)|(rs1<<15))
+}
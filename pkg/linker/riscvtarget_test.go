@@ -0,0 +1,146 @@
+package linker_test
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"github.com/ksco/rvld/pkg/linker"
+	"os"
+	"testing"
+)
+
+func signExtend(val uint32, bits int) int64 {
+	return int64(int32(val<<(32-bits)) >> (32 - bits))
+}
+
+// The fixtures load value with lui/ld (lw on RV32), call get with
+// auipc/jalr, and store the address of value in ptr. The .o files are
+// checked in because the build machine may lack a RISC-V assembler;
+// each .s file says how its object was made.
+func TestRiscvTarget(t *testing.T) {
+	tests := []struct {
+		input     string
+		class     elf.Class
+		wordSize  int
+		loadWidth uint32
+	}{
+		{"riscv64.o", elf.ELFCLASS64, 8, 3},
+		{"riscv32.o", elf.ELFCLASS32, 4, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			args := linker.NewContextArgs()
+			args.Output = "out"
+			out := &bufferAt{}
+			res, err := linker.Link(context.Background(), linker.Config{
+				Args:   args,
+				Inputs: []linker.Input{{Name: test.input}},
+				FS:     os.DirFS("testdata"),
+				Output: out,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", res.Warnings)
+			}
+
+			f, err := elf.NewFile(bytes.NewReader(out.buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Machine != elf.EM_RISCV || f.Class != test.class ||
+				f.Type != elf.ET_EXEC {
+				t.Fatalf("got %v %v %v, want a RISC-V %v executable",
+					f.Machine, f.Class, f.Type, test.class)
+			}
+
+			// The output has no symbol table yet, so find the symbols
+			// from the layout: _start is the entry point, get is the
+			// last instruction of the code, and value and ptr are the
+			// last two words of the data segment.
+			var text, data *elf.Prog
+			for _, prog := range f.Progs {
+				if prog.Type != elf.PT_LOAD {
+					continue
+				}
+				if prog.Flags&elf.PF_X != 0 {
+					text = prog
+				} else if prog.Flags&elf.PF_W != 0 {
+					data = prog
+				}
+			}
+			if text == nil || data == nil {
+				t.Fatal("missing code or data segment")
+			}
+			addrs := map[string]uint64{
+				"_start": f.Entry,
+				"get":    text.Vaddr + text.Filesz - 4,
+				"value":  data.Vaddr + data.Filesz - 2*uint64(test.wordSize),
+				"ptr":    data.Vaddr + data.Filesz - uint64(test.wordSize),
+			}
+			if f.Entry != text.Vaddr || res.Entry != f.Entry {
+				t.Errorf("entry is 0x%x (result 0x%x), want the start of the code at 0x%x",
+					f.Entry, res.Entry, text.Vaddr)
+			}
+
+			read := func(addr uint64, n int) []byte {
+				for _, prog := range f.Progs {
+					if prog.Type == elf.PT_LOAD && prog.Vaddr <= addr &&
+						addr+uint64(n) <= prog.Vaddr+prog.Filesz {
+						buf := make([]byte, n)
+						if _, err := prog.ReadAt(buf, int64(addr-prog.Vaddr)); err != nil {
+							t.Fatal(err)
+						}
+						return buf
+					}
+				}
+				t.Fatalf("0x%x is not in a loadable segment", addr)
+				return nil
+			}
+
+			insn := func(addr uint64) uint32 {
+				return binary.LittleEndian.Uint32(read(addr, 4))
+			}
+
+			start := addrs["_start"]
+			lui, load := insn(start), insn(start+4)
+			if lui&0x7f != 0x37 || load&0x7f != 0x03 || (load>>12)&7 != test.loadWidth {
+				t.Fatalf("unexpected instructions 0x%08x 0x%08x", lui, load)
+			}
+			got := uint64(signExtend(lui&0xfffff000, 32) + signExtend(load>>20, 12))
+			if test.class == elf.ELFCLASS32 {
+				got = uint64(uint32(got))
+			}
+			if got != addrs["value"] {
+				t.Errorf("lui/load address 0x%x, want value at 0x%x", got, addrs["value"])
+			}
+
+			auipc, jalr := insn(start+8), insn(start+12)
+			if auipc&0x7f != 0x17 || jalr&0x7f != 0x67 {
+				t.Fatalf("unexpected call 0x%08x 0x%08x", auipc, jalr)
+			}
+			offset := signExtend(auipc&0xfffff000, 32) + signExtend(jalr>>20, 12)
+			if start+8+uint64(offset) != addrs["get"] {
+				t.Errorf("call goes to 0x%x, want get at 0x%x",
+					start+8+uint64(offset), addrs["get"])
+			}
+
+			ptr := read(addrs["ptr"], test.wordSize)
+			var val uint64
+			if test.wordSize == 8 {
+				val = binary.LittleEndian.Uint64(ptr)
+			} else {
+				val = uint64(binary.LittleEndian.Uint32(ptr))
+			}
+			if val != addrs["value"] {
+				t.Errorf("ptr holds 0x%x, want value at 0x%x", val, addrs["value"])
+			}
+			if v := read(addrs["value"], 1)[0]; v != 42 {
+				t.Errorf("value is %d, want 42", v)
+			}
+		})
+	}
+}
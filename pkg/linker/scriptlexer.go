@@ -0,0 +1,82 @@
+package linker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scriptLexer splits version scripts and linker scripts into tokens.
+// Each character of punct is a token of its own.
+type scriptLexer struct {
+	data  []byte
+	punct string
+	pos   int
+	line  int
+}
+
+func newScriptLexer(data []byte, punct string) *scriptLexer {
+	return &scriptLexer{data: data, punct: punct, line: 1}
+}
+
+func (l *scriptLexer) errorf(format string, a ...any) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, a...))
+}
+
+// next returns the next token, or "" at the end of the input. Quoted
+// strings are returned with their quotes, so that they can be told
+// apart from patterns.
+func (l *scriptLexer) next() (string, error) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '*':
+			end := strings.Index(string(l.data[l.pos+2:]), "*/")
+			if end == -1 {
+				return "", l.errorf("unterminated comment")
+			}
+			comment := l.data[l.pos : l.pos+end+4]
+			l.line += strings.Count(string(comment), "\n")
+			l.pos += len(comment)
+		case strings.IndexByte(l.punct, c) >= 0:
+			l.pos++
+			return string(c), nil
+		case c == '"':
+			end := strings.IndexByte(string(l.data[l.pos+1:]), '"')
+			if end == -1 {
+				return "", l.errorf("unterminated string")
+			}
+			tok := string(l.data[l.pos : l.pos+end+2])
+			l.pos += len(tok)
+			return tok, nil
+		default:
+			start := l.pos
+			for l.pos < len(l.data) &&
+				strings.IndexByte(l.punct, l.data[l.pos]) == -1 &&
+				strings.IndexByte("\" \t\r\n", l.data[l.pos]) == -1 {
+				l.pos++
+			}
+			return string(l.data[start:l.pos]), nil
+		}
+	}
+	return "", nil
+}
+
+func (l *scriptLexer) expect(want string) error {
+	tok, err := l.next()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return l.errorf("expected '%s', got '%s'", want, tok)
+	}
+	return nil
+}
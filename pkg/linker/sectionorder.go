@@ -0,0 +1,159 @@
+package linker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/ksco/rvld/pkg/utils"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type SortSectionKind = uint8
+
+const (
+	SortSectionNone SortSectionKind = iota
+	SortSectionName
+	SortSectionAlignment
+)
+
+func ParseSortSection(arg string) (SortSectionKind, bool) {
+	switch arg {
+	case "name":
+		return SortSectionName, true
+	case "alignment":
+		return SortSectionAlignment, true
+	}
+	return SortSectionNone, false
+}
+
+// readOrderingFile returns the non-empty lines of an ordering file,
+// with "#" comments removed.
+func readOrderingFile(ctx *Context, filename string) []string {
+	contents, err := readFile(ctx, filename)
+	if err != nil {
+		fail(&LinkError{File: filename, Err: err})
+	}
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// computeSectionRanks assigns a rank to every input section named by
+// the ordering files. Sections defining a symbol from the symbol
+// ordering file come first, in the order of that file, followed by
+// sections matching a pattern of the section ordering file.
+func computeSectionRanks(ctx *Context) map[*InputSection]int {
+	ranks := make(map[*InputSection]int)
+	setRank := func(isec *InputSection, rank int) {
+		if r, ok := ranks[isec]; !ok || rank < r {
+			ranks[isec] = rank
+		}
+	}
+
+	base := 0
+	if ctx.Args.SymbolOrderingFile != "" {
+		names := readOrderingFile(ctx, ctx.Args.SymbolOrderingFile)
+		order := make(map[string]int, len(names))
+		for i, name := range names {
+			if _, ok := order[name]; !ok {
+				order[name] = i
+			}
+		}
+
+		found := make(map[string]bool)
+		for _, file := range ctx.Objs {
+			for i, sym := range file.Symbols {
+				rank, ok := order[sym.Name]
+				if i == 0 || !ok || sym.File != file {
+					continue
+				}
+
+				found[sym.Name] = true
+				if isec := sym.InputSection; isec != nil && isec.IsAlive {
+					setRank(isec, rank)
+				}
+			}
+		}
+
+		for _, name := range names {
+			if !found[name] {
+				ctx.Warn(&LinkError{
+					File: ctx.Args.SymbolOrderingFile,
+					Err:  errors.New("no such symbol: " + name),
+				})
+				found[name] = true
+			}
+		}
+		base = len(names)
+	}
+
+	if ctx.Args.SectionOrderingFile != "" {
+		patterns := readOrderingFile(ctx, ctx.Args.SectionOrderingFile)
+		for _, file := range ctx.Objs {
+			for _, isec := range file.Sections {
+				if isec == nil || !isec.IsAlive {
+					continue
+				}
+
+				name := isec.Name()
+				for i, pattern := range patterns {
+					if ok, _ := path.Match(pattern, name); ok {
+						setRank(isec, base+i)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return ranks
+}
+
+// getInitPriority returns the priority encoded in the name of a
+// constructor or destructor section, such as .init_array.101 or
+// .ctors.65434. Sections without a priority sort after those with one
+// in .init_array and .fini_array, and before them in .ctors and .dtors,
+// which run backwards. A .ctors.N or .dtors.N moved into an array has
+// priority 65535-N, as GNU ld assigns it.
+func getInitPriority(isec *InputSection) int {
+	name := isec.Name()
+	for _, stem := range []string{".init_array", ".fini_array", ".ctors", ".dtors"} {
+		rest, ok := utils.RemovePrefix(name, stem+".")
+		if !ok {
+			continue
+		}
+		if prio, err := strconv.Atoi(rest); err == nil {
+			if isec.Reverse {
+				return math.MaxUint16 - prio
+			}
+			return prio
+		}
+	}
+
+	if !isec.Reverse &&
+		(strings.HasPrefix(name, ".ctors") || strings.HasPrefix(name, ".dtors")) {
+		return -1
+	}
+	return math.MaxUint16 + 1
+}
+
+func isInitArrayOutput(osec *OutputSection) bool {
+	switch osec.Name {
+	case ".init_array", ".fini_array", ".ctors", ".dtors":
+		return true
+	}
+	return false
+}
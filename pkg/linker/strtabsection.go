@@ -0,0 +1,32 @@
+package linker
+
+import "debug/elf"
+
+type StrtabSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewStrtabSection(name string) *StrtabSection {
+	s := &StrtabSection{Chunk: NewChunk(), Contents: []byte{0}}
+	s.Name = name
+	s.Shdr.Type = uint32(elf.SHT_STRTAB)
+	s.Shdr.Size = 1
+	return s
+}
+
+func (s *StrtabSection) AddString(str string) uint32 {
+	if str == "" {
+		return 0
+	}
+
+	offset := uint32(len(s.Contents))
+	s.Contents = append(s.Contents, str...)
+	s.Contents = append(s.Contents, 0)
+	s.Shdr.Size = uint64(len(s.Contents))
+	return offset
+}
+
+func (s *StrtabSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[s.Shdr.Offset:], s.Contents)
+}
@@ -1,22 +1,41 @@
 package linker
 
-import "github.com/ksco/rvld/pkg/utils"
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+	"strings"
+	"sync"
+)
 
 const (
 	NeedsGotTp uint32 = 1 << 0
+	NeedsGot   uint32 = 1 << 1
 )
 
 type Symbol struct {
-	File     *ObjectFile
-	Name     string
-	Value    uint64
-	SymIdx   int
-	GotTpIdx int32
+	File      *ObjectFile
+	Name      string
+	Value     uint64
+	SymIdx    int
+	GotIdx    int32
+	GotTpIdx  int32
+	SymtabIdx int32
 
 	InputSection    *InputSection
 	SectionFragment *SectionFragment
 
-	Flags uint32
+	Flags  uint32
+	Traced bool
+
+	// Visibility is the most restrictive visibility any file gives
+	// the symbol.
+	Visibility uint8
+
+	// Redirect is what undefined references to this symbol resolve to
+	// instead, if set. It implements --wrap.
+	Redirect *Symbol
+
+	Mu sync.Mutex
 }
 
 func NewSymbol(name string) *Symbol {
@@ -38,15 +57,14 @@ func (s *Symbol) SetSectionFragment(frag *SectionFragment) {
 }
 
 func GetSymbolByName(ctx *Context, name string) *Symbol {
-	if sym, ok := ctx.SymbolMap[name]; ok {
-		return sym
-	}
-	ctx.SymbolMap[name] = NewSymbol(name)
-	return ctx.SymbolMap[name]
+	sym, _ := ctx.SymbolMap.GetOrInsert(name, func() *Symbol {
+		return NewSymbol(name)
+	})
+	return sym
 }
 
 func (s *Symbol) ElfSym() *Sym {
-	utils.Assert(s.SymIdx < len(s.File.ElfSyms))
+	assert(s.SymIdx < len(s.File.ElfSyms))
 	return &s.File.ElfSyms[s.SymIdx]
 }
 
@@ -68,6 +86,55 @@ func (s *Symbol) GetAddr() uint64 {
 	return s.Value
 }
 
+func (s *Symbol) AddFlags(flags uint32) {
+	s.Mu.Lock()
+	s.Flags |= flags
+	s.Mu.Unlock()
+}
+
+func (s *Symbol) GetGotAddr(ctx *Context) uint64 {
+	return ctx.Got.Shdr.Addr + uint64(s.GotIdx)*ctx.WordSize()
+}
+
 func (s *Symbol) GetGotTpAddr(ctx *Context) uint64 {
-	return ctx.Got.Shdr.Addr + uint64(s.GotTpIdx)*8
+	return ctx.Got.Shdr.Addr + uint64(s.GotTpIdx)*ctx.WordSize()
+}
+
+// GetVersion returns the version the defining file gives the symbol by
+// naming it foo@VER or foo@@VER, and whether it is hidden, which it is
+// unless it is the default version. It returns "" if there is none.
+func (s *Symbol) GetVersion() (string, bool) {
+	if s.File == nil || s.File.SymbolStrtab == nil {
+		return "", false
+	}
+
+	name := ElfGetName(s.File.SymbolStrtab, s.ElfSym().Name)
+	at := strings.Index(name, "@")
+	if at <= 0 {
+		return "", false
+	}
+	if ver, ok := utils.RemovePrefix(name[at+1:], "@"); ok {
+		return ver, false
+	}
+	return name[at+1:], true
+}
+
+// mergeVisibility returns the more restrictive of two visibilities.
+func mergeVisibility(a, b uint8) uint8 {
+	rank := func(vis uint8) int {
+		switch elf.SymVis(vis) {
+		case elf.STV_INTERNAL:
+			return 3
+		case elf.STV_HIDDEN:
+			return 2
+		case elf.STV_PROTECTED:
+			return 1
+		}
+		return 0
+	}
+
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
 }
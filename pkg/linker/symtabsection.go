@@ -0,0 +1,160 @@
+package linker
+
+import "debug/elf"
+
+type SymtabEntry struct {
+	Sym   *Symbol
+	Esym  Sym
+	Chunk Chunker
+}
+
+// SymtabSection is the output .symtab. It starts with one section
+// symbol per output section, followed by the local symbols of every
+// file and then by each global symbol exactly once. In an executable,
+// globals that are hidden or that the version script makes local are
+// turned into local symbols.
+type SymtabSection struct {
+	Chunk
+	Entries     []SymtabEntry
+	SectionSyms map[Chunker]uint32
+}
+
+func NewSymtabSection() *SymtabSection {
+	s := &SymtabSection{Chunk: NewChunk()}
+	s.Name = ".symtab"
+	s.Shdr.Type = uint32(elf.SHT_SYMTAB)
+	return s
+}
+
+func isSymbolLive(sym *Symbol, esym *Sym) bool {
+	if esym.IsAbs() || esym.IsCommon() || sym.SectionFragment != nil {
+		return true
+	}
+	return sym.InputSection != nil && sym.InputSection.IsAlive
+}
+
+func (s *SymtabSection) add(ctx *Context, sym *Symbol, esym Sym) {
+	sym.SymtabIdx = int32(len(s.Entries))
+	esym.Name = ctx.Strtab.AddString(sym.Name)
+	s.Entries = append(s.Entries, SymtabEntry{Sym: sym, Esym: esym})
+}
+
+// Build assigns symbol table indices. It has to run after every output
+// section has got its section index.
+func (s *SymtabSection) Build(ctx *Context) {
+	s.Entries = []SymtabEntry{{}}
+	s.SectionSyms = make(map[Chunker]uint32)
+
+	for _, chunk := range ctx.Chunks {
+		switch chunk.(type) {
+		case *OutputSection, *MergedSection:
+			if chunk.GetShndx() == 0 {
+				continue
+			}
+			s.SectionSyms[chunk] = uint32(len(s.Entries))
+			s.Entries = append(s.Entries, SymtabEntry{
+				Esym:  Sym{Info: uint8(elf.STT_SECTION)},
+				Chunk: chunk,
+			})
+		}
+	}
+
+	for _, file := range ctx.Objs {
+		for i := 1; i < file.FirstGlobal; i++ {
+			sym := &file.LocalSymbols[i]
+			esym := &file.ElfSyms[i]
+			if esym.Type() != uint8(elf.STT_SECTION) && isSymbolLive(sym, esym) {
+				s.add(ctx, sym, *esym)
+			}
+		}
+	}
+
+	files := ctx.Objs
+	if ctx.InternalObj != nil {
+		files = append(files[:len(files):len(files)], ctx.InternalObj)
+	}
+
+	addGlobals := func(local bool) {
+		for _, file := range files {
+			for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+				sym := file.Symbols[i]
+				if sym.SymtabIdx != 0 {
+					continue
+				}
+
+				if sym.File == file && isSymbolLive(sym, sym.ElfSym()) {
+					esym := *sym.ElfSym()
+					vis := mergeVisibility(sym.Visibility, esym.Visibility())
+					if isLocalInOutput(ctx, sym, vis) != local {
+						continue
+					}
+
+					esym.Other = esym.Other&^3 | vis
+					if local {
+						esym.Info = uint8(elf.STB_LOCAL)<<4 | esym.Type()
+					}
+					s.add(ctx, sym, esym)
+				} else if sym.File == nil && !local {
+					esym := file.ElfSyms[i]
+					esym.Shndx = uint16(elf.SHN_UNDEF)
+					esym.Val = 0
+					esym.Size = 0
+					s.add(ctx, sym, esym)
+				}
+			}
+		}
+	}
+
+	addGlobals(true)
+	s.Shdr.Info = uint32(len(s.Entries))
+	addGlobals(false)
+
+	s.Shdr.Size = uint64(len(s.Entries) * GetSymSize(ctx.Class()))
+	s.Shdr.EntSize = uint64(GetSymSize(ctx.Class()))
+	s.Shdr.AddrAlign = ctx.WordSize()
+	s.Shdr.Link = uint32(ctx.Strtab.Shndx)
+}
+
+func isLocalInOutput(ctx *Context, sym *Symbol, vis uint8) bool {
+	if ctx.Args.Relocatable {
+		return false
+	}
+	if vis == uint8(elf.STV_HIDDEN) || vis == uint8(elf.STV_INTERNAL) {
+		return true
+	}
+
+	// A symbol named with its version isn't subject to the patterns.
+	if ver, _ := sym.GetVersion(); ver != "" {
+		return false
+	}
+	return ctx.VersionScript != nil && ctx.VersionScript.IsLocal(sym.Name)
+}
+
+func getOutputShndx(sym *Symbol, esym *Sym) uint16 {
+	switch {
+	case esym.IsUndef(), esym.IsAbs(), esym.IsCommon():
+		return esym.Shndx
+	case sym.SectionFragment != nil:
+		return uint16(sym.SectionFragment.OutputSection.Shndx)
+	}
+	return uint16(sym.InputSection.OutputSection.Shndx)
+}
+
+func (s *SymtabSection) CopyBuf(ctx *Context) {
+	syms := make([]Sym, len(s.Entries))
+	for i, ent := range s.Entries[1:] {
+		esym := ent.Esym
+		if ent.Chunk != nil {
+			esym.Shndx = uint16(ent.Chunk.GetShndx())
+			esym.Val = ent.Chunk.GetShdr().Addr
+		} else {
+			esym.Shndx = getOutputShndx(ent.Sym, &ent.Esym)
+			if !esym.IsUndef() && !esym.IsCommon() {
+				esym.Val = ent.Sym.GetAddr()
+			}
+		}
+		syms[i+1] = esym
+	}
+
+	WriteSyms(ctx.Class(), ctx.Buf[s.Shdr.Offset:], syms)
+}
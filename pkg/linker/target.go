@@ -0,0 +1,56 @@
+package linker
+
+import "debug/elf"
+
+// Target describes everything the linker needs to know about one
+// architecture. Backends register themselves from an init function
+// and are looked up by MachineType.
+type Target interface {
+	MachineType() MachineType
+	Machine() elf.Machine
+	Class() elf.Class
+	PageSize() uint64
+	ImageBase() uint64
+
+	// CheckFlags rejects inputs whose e_flags can't be linked together,
+	// and GetEhdrFlags computes e_flags for the output.
+	CheckFlags(ctx *Context)
+	GetEhdrFlags(ctx *Context) uint32
+
+	// GetTpAddr returns the address the thread pointer points to,
+	// given the PT_TLS segment.
+	GetTpAddr(tls *Phdr) uint64
+
+	// ScanRelocations sets the Needs* flags of the symbols that require
+	// GOT entries, and ApplyRelocAlloc applies the relocations of isec
+	// to its copy in base.
+	ScanRelocations(ctx *Context, isec *InputSection)
+	ApplyRelocAlloc(ctx *Context, isec *InputSection, base []byte)
+
+	// ApplyRelocNonAlloc does the same for sections that aren't loaded,
+	// such as debug info, whose relocations are absolute or differences
+	// and may refer to discarded sections.
+	ApplyRelocNonAlloc(ctx *Context, isec *InputSection, base []byte)
+
+	// PltEntrySize is the size of one PLT stub, and WritePltEntry writes
+	// the stub for sym into buf, jumping through its GOT entry. Static
+	// executables have no PLT, since calls through it resolve directly
+	// to the callee, so the backends return 0 and write nothing.
+	PltEntrySize() uint64
+	WritePltEntry(ctx *Context, buf []byte, sym *Symbol)
+}
+
+var targets []Target
+
+func RegisterTarget(t Target) {
+	targets = append(targets, t)
+}
+
+func GetTarget(m MachineType) Target {
+	for _, t := range targets {
+		if t.MachineType() == m {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+# llvm-mc -triple=riscv64 -mattr=-relax -filetype=obj bench.s -o bench.o
+#
+# Many symbols and relocations, for benchmarking input parsing.
+
+	.macro func
+	.text
+	.globl f\@
+f\@:
+	lui a0, %hi(d\@)
+	addi a0, a0, %lo(d\@)
+	call ext\@
+	ret
+
+	.data
+d\@:
+	.quad f\@
+	.quad ext\@
+	.endm
+
+	.rept 250
+	func
+	.endr
+
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,24 @@
+# llvm-mc -triple=riscv32 -mattr=-relax -filetype=obj riscv32.s -o riscv32.o
+
+	.text
+	.globl _start
+_start:
+	lui a0, %hi(value)
+	lw a0, %lo(value)(a0)
+	call get
+	li a7, 93
+	ecall
+
+	.section .text.get,"ax",@progbits
+	.globl get
+get:
+	ret
+
+	.data
+	.globl value, ptr
+value:
+	.word 42
+ptr:
+	.word value
+
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,20 @@
+# llvm-mc -triple=riscv64 -mattr=+relax -filetype=obj riscv64-partial.s -o riscv64-partial.o
+
+	.attribute arch, "rv64i2p0_m2p0"
+	.attribute stack_align, 16
+
+	.text
+	.globl load
+	ret
+	.p2align 4
+load:
+1:	auipc a0, %pcrel_hi(value)
+	ld a0, %pcrel_lo(1b)(a0)
+	ret
+
+	.section .text.inline,"axG",@progbits,inline,comdat
+	.weak inline
+inline:
+	ret
+
+	.section .note.GNU-stack,"",@progbits
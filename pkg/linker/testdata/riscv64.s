@@ -0,0 +1,24 @@
+# llvm-mc -triple=riscv64 -mattr=-relax -filetype=obj riscv64.s -o riscv64.o
+
+	.text
+	.globl _start
+_start:
+	lui a0, %hi(value)
+	ld a0, %lo(value)(a0)
+	call get
+	li a7, 93
+	ecall
+
+	.section .text.get,"ax",@progbits
+	.globl get
+get:
+	ret
+
+	.data
+	.globl value, ptr
+value:
+	.dword 42
+ptr:
+	.dword value
+
+	.section .note.GNU-stack,"",@progbits
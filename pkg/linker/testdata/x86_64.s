@@ -0,0 +1,33 @@
+# llvm-mc -triple=x86_64 -filetype=obj x86_64.s -o x86_64.o
+
+	.text
+	.globl _start
+_start:
+	movq value@GOTPCREL(%rip), %rax
+	movl (%rax), %edi
+	call get@PLT
+	movq counter@GOTTPOFF(%rip), %rax
+	movl $60, %eax
+	syscall
+
+	.globl get
+get:
+	ret
+
+	.data
+	.globl value
+value:
+	.long 42
+
+	.globl ptr
+	.p2align 3
+ptr:
+	.quad value
+
+	.section .tdata,"awT",@progbits
+	.globl counter
+	.p2align 3
+counter:
+	.quad 7
+
+	.section .note.GNU-stack,"",@progbits
@@ -0,0 +1,74 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+	"path/filepath"
+)
+
+const VER_FLG_BASE uint16 = 1
+
+// VerdefSection is .gnu.version_d, which defines the versions of the
+// version script. The first definition is the base version, named after
+// the output file. Each node is followed by the names of the nodes it
+// depends on.
+type VerdefSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewVerdefSection() *VerdefSection {
+	v := &VerdefSection{Chunk: NewChunk()}
+	v.Name = ".gnu.version_d"
+	v.Shdr.Type = uint32(elf.SHT_GNU_VERDEF)
+	v.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	v.Shdr.AddrAlign = 4
+	return v
+}
+
+func (v *VerdefSection) Build(ctx *Context) {
+	nodes := ctx.VersionScript.Nodes
+	v.Contents = make([]byte, 0)
+
+	add := func(ndx, flags uint16, name string, parents []string) {
+		names := append([]string{name}, parents...)
+		def := Verdef{
+			Version: 1,
+			Flags:   flags,
+			Ndx:     ndx,
+			Cnt:     uint16(len(names)),
+			Hash:    elfHash(name),
+			Aux:     uint32(VerdefSize),
+		}
+		if int(ndx) <= len(nodes) {
+			def.Next = uint32(VerdefSize + len(names)*VerdauxSize)
+		}
+
+		buf := make([]byte, VerdefSize+len(names)*VerdauxSize)
+		utils.Write[Verdef](buf, def)
+		for i, name := range names {
+			aux := Verdaux{Name: ctx.Dynstr.AddString(name)}
+			if i < len(names)-1 {
+				aux.Next = uint32(VerdauxSize)
+			}
+			utils.Write[Verdaux](buf[VerdefSize+i*VerdauxSize:], aux)
+		}
+		v.Contents = append(v.Contents, buf...)
+	}
+
+	add(VER_NDX_GLOBAL, VER_FLG_BASE, filepath.Base(ctx.Args.Output), nil)
+	for i, node := range nodes {
+		add(uint16(i+2), 0, node.Name, node.Parents)
+	}
+
+	v.Shdr.Size = uint64(len(v.Contents))
+	v.Shdr.Info = uint32(len(nodes) + 1)
+}
+
+func (v *VerdefSection) UpdateShdr(ctx *Context) {
+	v.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+}
+
+func (v *VerdefSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[v.Shdr.Offset:], v.Contents)
+}
@@ -0,0 +1,269 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// VersionScript is a parsed --version-script file. Each node names a
+// version, except for the anonymous node of a script that only decides
+// which symbols are global and which are local.
+type VersionScript struct {
+	Nodes []*VersionNode
+}
+
+type VersionNode struct {
+	Name    string
+	Parents []string
+	Global  []VersionPattern
+	Local   []VersionPattern
+}
+
+type VersionPattern struct {
+	Pattern string
+	IsGlob  bool
+}
+
+func ReadVersionScript(ctx *Context, filename string) *VersionScript {
+	contents, err := readFile(ctx, filename)
+	if err != nil {
+		fail(&LinkError{File: filename, Err: err})
+	}
+
+	script, err := ParseVersionScript(contents)
+	if err != nil {
+		fail(&LinkError{File: filename, Err: err})
+	}
+	return script
+}
+
+// ReadDynamicList reads a --dynamic-list file, which has the syntax of
+// an anonymous version node whose patterns are all global.
+func ReadDynamicList(ctx *Context, filename string) *VersionScript {
+	script := ReadVersionScript(ctx, filename)
+	for _, node := range script.Nodes {
+		if node.Name != "" || len(node.Local) > 0 || len(node.Parents) > 0 {
+			fail(&LinkError{File: filename, Err: errors.New(
+				"a dynamic list can only have global patterns")})
+		}
+	}
+	return script
+}
+
+func ParseVersionScript(data []byte) (*VersionScript, error) {
+	l := newScriptLexer(data, "{};:")
+	script := &VersionScript{}
+	names := make(map[string]bool)
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok == "" {
+			break
+		}
+
+		node := &VersionNode{}
+		if tok != "{" {
+			if strings.ContainsAny(tok, "};:\"") {
+				return nil, l.errorf("unexpected '%s'", tok)
+			}
+			if names[tok] {
+				return nil, l.errorf("duplicate version node: %s", tok)
+			}
+			names[tok] = true
+			node.Name = tok
+			if err := l.expect("{"); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := parseVersionNodeBody(l, node); err != nil {
+			return nil, err
+		}
+
+		for {
+			tok, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			if tok == ";" {
+				break
+			}
+			if tok == "" || strings.ContainsAny(tok, "{}:\"") {
+				return nil, l.errorf("expected ';', got '%s'", tok)
+			}
+			node.Parents = append(node.Parents, tok)
+		}
+
+		script.Nodes = append(script.Nodes, node)
+	}
+
+	for _, node := range script.Nodes {
+		if node.Name == "" && len(script.Nodes) > 1 {
+			return nil, errors.New(
+				"anonymous version node cannot be combined with other version nodes")
+		}
+		for _, parent := range node.Parents {
+			if !names[parent] {
+				return nil, fmt.Errorf("%s: unknown version dependency: %s",
+					node.Name, parent)
+			}
+		}
+	}
+	return script, nil
+}
+
+// parseVersionNodeBody reads the patterns of a node up to its closing brace.
+// Patterns are global until a "local:" label.
+func parseVersionNodeBody(l *scriptLexer, node *VersionNode) error {
+	isLocal := false
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case "}":
+			return nil
+		case "", "{", ";", ":":
+			return l.errorf("unexpected '%s'", tok)
+		case "global", "local":
+			if err := l.expect(":"); err != nil {
+				return err
+			}
+			isLocal = tok == "local"
+			continue
+		case "extern":
+			lang, err := l.next()
+			if err != nil {
+				return err
+			}
+			if lang != `"C"` {
+				return l.errorf("unsupported language: %s", lang)
+			}
+			if err := l.expect("{"); err != nil {
+				return err
+			}
+			if err := parseVersionPatterns(l, node, isLocal); err != nil {
+				return err
+			}
+		default:
+			if err := addVersionPattern(l, node, tok, isLocal); err != nil {
+				return err
+			}
+		}
+
+		if err := l.expect(";"); err != nil {
+			return err
+		}
+	}
+}
+
+// parseVersionPatterns reads the patterns of an extern block, where the
+// semicolon after the last one may be left out.
+func parseVersionPatterns(l *scriptLexer, node *VersionNode, isLocal bool) error {
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "}":
+			return nil
+		case ";":
+			continue
+		case "", "{", ":":
+			return l.errorf("unexpected '%s'", tok)
+		}
+		if err := addVersionPattern(l, node, tok, isLocal); err != nil {
+			return err
+		}
+	}
+}
+
+func addVersionPattern(l *scriptLexer, node *VersionNode, tok string, isLocal bool) error {
+	pat := VersionPattern{Pattern: tok}
+	if strings.HasPrefix(tok, `"`) {
+		pat.Pattern = tok[1 : len(tok)-1]
+	} else if strings.ContainsAny(tok, "*?[") {
+		if _, err := path.Match(tok, ""); err != nil {
+			return l.errorf("invalid pattern: %s", tok)
+		}
+		pat.IsGlob = true
+	}
+
+	if isLocal {
+		node.Local = append(node.Local, pat)
+	} else {
+		node.Global = append(node.Global, pat)
+	}
+	return nil
+}
+
+// Match finds the pattern that decides the symbol. An exact name takes
+// precedence over a wildcard, and any wildcard over a lone "*". Among
+// equals, the first match wins, and the global patterns of a node come
+// before its local ones. It returns the index of the node the pattern
+// is in, or -1 if nothing matches, and whether the pattern is local.
+func (s *VersionScript) Match(name string) (int, bool) {
+	best, idx, isLocal := 3, -1, false
+	consider := func(i int, pats []VersionPattern, local bool) {
+		for _, pat := range pats {
+			rank := 0
+			if pat.IsGlob {
+				if ok, _ := path.Match(pat.Pattern, name); !ok {
+					continue
+				}
+				rank = 1
+				if pat.Pattern == "*" {
+					rank = 2
+				}
+			} else if pat.Pattern != name {
+				continue
+			}
+
+			if rank < best {
+				best, idx, isLocal = rank, i, local
+			}
+		}
+	}
+
+	for i, node := range s.Nodes {
+		consider(i, node.Global, false)
+		consider(i, node.Local, true)
+	}
+	return idx, isLocal
+}
+
+func (s *VersionScript) IsLocal(name string) bool {
+	_, isLocal := s.Match(name)
+	return isLocal
+}
+
+// IsGlobal reports whether a global pattern matches the symbol.
+func (s *VersionScript) IsGlobal(name string) bool {
+	idx, isLocal := s.Match(name)
+	return idx >= 0 && !isLocal
+}
+
+// HasVersions reports whether the script defines named versions, which
+// go into .gnu.version_d.
+func (s *VersionScript) HasVersions() bool {
+	return len(s.Nodes) > 0 && s.Nodes[0].Name != ""
+}
+
+// FindVersion returns the .gnu.version index of the named node. Index 1
+// is the base version of the output, so the nodes start at 2.
+func (s *VersionScript) FindVersion(name string) (uint16, bool) {
+	for i, node := range s.Nodes {
+		if node.Name != "" && node.Name == name {
+			return uint16(i + 2), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,32 @@
+package linker
+
+import (
+	"debug/elf"
+	"github.com/ksco/rvld/pkg/utils"
+)
+
+// VersymSection is .gnu.version, which gives the version index of each
+// .dynsym entry.
+type VersymSection struct {
+	Chunk
+}
+
+func NewVersymSection() *VersymSection {
+	v := &VersymSection{Chunk: NewChunk()}
+	v.Name = ".gnu.version"
+	v.Shdr.Type = uint32(elf.SHT_GNU_VERSYM)
+	v.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	v.Shdr.AddrAlign = 2
+	v.Shdr.EntSize = 2
+	return v
+}
+
+func (v *VersymSection) UpdateShdr(ctx *Context) {
+	v.Shdr.Size = uint64(len(ctx.Dynsym.Versions)+1) * 2
+	v.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+}
+
+func (v *VersymSection) CopyBuf(ctx *Context) {
+	versions := append([]uint16{VER_NDX_LOCAL}, ctx.Dynsym.Versions...)
+	utils.WriteSlice(ctx.Buf[v.Shdr.Offset:], versions)
+}
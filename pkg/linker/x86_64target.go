@@ -0,0 +1,176 @@
+package linker
+
+import (
+	"debug/elf"
+	"fmt"
+	"github.com/ksco/rvld/pkg/utils"
+	"math"
+)
+
+// X86_64Target links static, non-PIE x86-64 executables. It doesn't
+// relax GOT loads, so every GOTPCREL reference gets a GOT entry.
+type X86_64Target struct{}
+
+func init() {
+	RegisterTarget(&X86_64Target{})
+}
+
+func (t *X86_64Target) MachineType() MachineType {
+	return MachineTypeX86_64
+}
+
+func (t *X86_64Target) Machine() elf.Machine {
+	return elf.EM_X86_64
+}
+
+func (t *X86_64Target) Class() elf.Class {
+	return elf.ELFCLASS64
+}
+
+func (t *X86_64Target) PageSize() uint64 {
+	return 4096
+}
+
+func (t *X86_64Target) ImageBase() uint64 {
+	return 0x400000
+}
+
+func (t *X86_64Target) CheckFlags(ctx *Context) {}
+
+func (t *X86_64Target) GetEhdrFlags(ctx *Context) uint32 {
+	return 0
+}
+
+// Calls through the PLT go straight to the callee in a static
+// executable, so there are no stubs.
+func (t *X86_64Target) PltEntrySize() uint64 {
+	return 0
+}
+
+func (t *X86_64Target) WritePltEntry(ctx *Context, buf []byte, sym *Symbol) {}
+
+// x86-64 uses TLS variant II: the thread pointer points just past the
+// TLS block, so TLS variables have negative offsets from it.
+func (t *X86_64Target) GetTpAddr(tls *Phdr) uint64 {
+	return utils.AlignTo(tls.VAddr+tls.MemSize, tls.Align)
+}
+
+func (t *X86_64Target) ScanRelocations(ctx *Context, i *InputSection) {
+	for _, rel := range i.GetRels() {
+		sym := i.File.Symbols[rel.Sym]
+		if sym.File == nil {
+			continue
+		}
+
+		switch elf.R_X86_64(rel.Type) {
+		case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX,
+			elf.R_X86_64_REX_GOTPCRELX:
+			sym.AddFlags(NeedsGot)
+		case elf.R_X86_64_GOTTPOFF:
+			sym.AddFlags(NeedsGotTp)
+		}
+	}
+}
+
+func (t *X86_64Target) ApplyRelocAlloc(ctx *Context, i *InputSection, base []byte) {
+	for _, rel := range i.GetRels() {
+		if rel.Type == uint32(elf.R_X86_64_NONE) {
+			continue
+		}
+
+		sym := i.File.Symbols[rel.Sym]
+		loc := base[rel.Offset:]
+
+		if sym.File == nil {
+			continue
+		}
+
+		S := sym.GetAddr()
+		A := uint64(rel.Addend)
+		P := i.GetAddr() + rel.Offset
+
+		write32 := func(val uint64, signed bool) {
+			ok := val <= math.MaxUint32
+			if signed {
+				ok = utils.SignExtend(val, 31) == val
+			}
+			if !ok {
+				i.fatal(rel.Offset, fmt.Sprintf("relocation %v out of range: %s",
+					elf.R_X86_64(rel.Type), sym.Name))
+			}
+			utils.Write[uint32](loc, uint32(val))
+		}
+
+		switch elf.R_X86_64(rel.Type) {
+		case elf.R_X86_64_64:
+			utils.Write[uint64](loc, S+A)
+		case elf.R_X86_64_32:
+			write32(S+A, false)
+		case elf.R_X86_64_32S:
+			write32(S+A, true)
+		case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
+			write32(S+A-P, true)
+		case elf.R_X86_64_PC64:
+			utils.Write[uint64](loc, S+A-P)
+		case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX,
+			elf.R_X86_64_REX_GOTPCRELX:
+			write32(sym.GetGotAddr(ctx)+A-P, true)
+		case elf.R_X86_64_GOTTPOFF:
+			write32(sym.GetGotTpAddr(ctx)+A-P, true)
+		case elf.R_X86_64_TPOFF32:
+			write32(S+A-ctx.TpAddr, true)
+		case elf.R_X86_64_TPOFF64:
+			utils.Write[uint64](loc, S+A-ctx.TpAddr)
+		default:
+			i.fatal(rel.Offset, fmt.Sprintf("unsupported relocation %v: %s",
+				elf.R_X86_64(rel.Type), sym.Name))
+		}
+	}
+}
+
+func (t *X86_64Target) ApplyRelocNonAlloc(ctx *Context, i *InputSection, base []byte) {
+	for _, rel := range i.GetRels() {
+		if rel.Type == uint32(elf.R_X86_64_NONE) {
+			continue
+		}
+
+		sym := i.File.Symbols[rel.Sym]
+		loc := base[rel.Offset:]
+		S, A, dead := i.getNonAllocTarget(rel)
+
+		val := func(v uint64) uint64 {
+			if dead {
+				return i.getTombstone()
+			}
+			return v
+		}
+
+		write32 := func(val uint64, signed bool) {
+			ok := val <= math.MaxUint32
+			if signed {
+				ok = utils.SignExtend(val, 31) == val
+			}
+			if !ok && !dead {
+				i.fatal(rel.Offset, fmt.Sprintf("relocation %v out of range: %s",
+					elf.R_X86_64(rel.Type), sym.Name))
+			}
+			utils.Write[uint32](loc, uint32(val))
+		}
+
+		switch elf.R_X86_64(rel.Type) {
+		case elf.R_X86_64_64:
+			utils.Write[uint64](loc, val(S+A))
+		case elf.R_X86_64_32:
+			write32(val(S+A), false)
+		case elf.R_X86_64_32S:
+			write32(val(S+A), true)
+		case elf.R_X86_64_DTPOFF32:
+			write32(val(S+A-ctx.TlsBegin), true)
+		case elf.R_X86_64_DTPOFF64:
+			utils.Write[uint64](loc, val(S+A-ctx.TlsBegin))
+		default:
+			i.fatal(rel.Offset, fmt.Sprintf("unsupported relocation %v: %s",
+				elf.R_X86_64(rel.Type), sym.Name))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package linker_test
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"github.com/ksco/rvld/pkg/linker"
+	"os"
+	"testing"
+)
+
+// The fixture loads value through the GOT, calls get through the PLT,
+// loads the TP offset of counter from the GOT and stores the address of
+// value in ptr.
+func TestX86_64Target(t *testing.T) {
+	args := linker.NewContextArgs()
+	args.Output = "out"
+	out := &bufferAt{}
+	res, err := linker.Link(context.Background(), linker.Config{
+		Args:   args,
+		Inputs: []linker.Input{{Name: "x86_64.o"}},
+		FS:     os.DirFS("testdata"),
+		Output: out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", res.Warnings)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(out.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Machine != elf.EM_X86_64 || f.Class != elf.ELFCLASS64 ||
+		f.Type != elf.ET_EXEC {
+		t.Fatalf("got %v %v %v, want an x86-64 executable",
+			f.Machine, f.Class, f.Type)
+	}
+	if f.Section(".plt") != nil {
+		t.Error("a static executable has a .plt")
+	}
+
+	// The output has no symbol table yet, so the symbols are found from
+	// the layout: _start is the entry point and the start of the code,
+	// get is the ret that ends it, counter starts the TLS segment and
+	// ptr follows value, which is found through the GOT.
+	var text *elf.Prog
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Flags&elf.PF_X != 0 {
+			text = prog
+		}
+	}
+	if text == nil {
+		t.Fatal("missing code segment")
+	}
+	if f.Entry != text.Vaddr {
+		t.Errorf("entry is 0x%x, want the start of the code at 0x%x",
+			f.Entry, text.Vaddr)
+	}
+	addrs := map[string]uint64{
+		"_start": f.Entry,
+		"get":    text.Vaddr + text.Filesz - 1,
+	}
+
+	var tp uint64
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_TLS {
+			addrs["counter"] = prog.Vaddr
+			tp = (prog.Vaddr + prog.Memsz + prog.Align - 1) &^ (prog.Align - 1)
+		}
+	}
+	if tp == 0 {
+		t.Fatal("PT_TLS is missing")
+	}
+
+	read := func(addr uint64, n int) []byte {
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_LOAD && prog.Vaddr <= addr &&
+				addr+uint64(n) <= prog.Vaddr+prog.Filesz {
+				buf := make([]byte, n)
+				if _, err := prog.ReadAt(buf, int64(addr-prog.Vaddr)); err != nil {
+					t.Fatal(err)
+				}
+				return buf
+			}
+		}
+		t.Fatalf("0x%x is not in a loadable segment", addr)
+		return nil
+	}
+
+	// target returns where the rel32 at addr points, given the address
+	// of the next instruction.
+	target := func(addr, next uint64) uint64 {
+		rel := int32(binary.LittleEndian.Uint32(read(addr, 4)))
+		return next + uint64(int64(rel))
+	}
+
+	start := addrs["_start"]
+	if code := read(start, 3); !bytes.Equal(code, []byte{0x48, 0x8b, 0x05}) {
+		t.Fatalf("unexpected instruction %x", code)
+	}
+	addrs["value"] = binary.LittleEndian.Uint64(read(target(start+3, start+7), 8))
+	addrs["ptr"] = addrs["value"] + 8
+
+	if dest := target(start+10, start+14); dest != addrs["get"] ||
+		read(dest, 1)[0] != 0xc3 {
+		t.Errorf("call goes to 0x%x, want get at 0x%x", dest, addrs["get"])
+	}
+
+	got := binary.LittleEndian.Uint64(read(target(start+17, start+21), 8))
+	if got != addrs["counter"]-tp {
+		t.Errorf("GOT entry holds TP offset 0x%x, want 0x%x",
+			got, addrs["counter"]-tp)
+	}
+
+	ptr := binary.LittleEndian.Uint64(read(addrs["ptr"], 8))
+	if ptr != addrs["value"] {
+		t.Errorf("ptr holds 0x%x, want value at 0x%x", ptr, addrs["value"])
+	}
+	if v := read(addrs["value"], 1)[0]; v != 42 {
+		t.Errorf("value is %d, want 42", v)
+	}
+}
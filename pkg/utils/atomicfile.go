@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// AtomicFile is an output file that only replaces its target once it is
+// complete. Until Commit is called the contents live in a temporary file
+// next to the target, so a failed or interrupted link never leaves a
+// truncated file behind.
+type AtomicFile struct {
+	File    *os.File
+	path    string
+	tmpPath string
+}
+
+func CreateAtomicFile(path string) (*AtomicFile, error) {
+	// Renaming over a device such as /dev/null would replace it, so
+	// anything but a regular file is written in place.
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		return createInPlace(path)
+	}
+
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+
+	for i := 0; i < 100; i++ {
+		tmpPath := filepath.Join(dir,
+			fmt.Sprintf(".%s.tmp%06d", base, rand.Intn(1000000)))
+
+		// The mode is subject to the umask, as for any new executable.
+		file, err := os.OpenFile(tmpPath,
+			os.O_RDWR|os.O_CREATE|os.O_EXCL, 0777)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			// We may not be allowed to create files in the directory
+			// even though the target itself is writable.
+			return createInPlace(path)
+		}
+
+		return &AtomicFile{File: file, path: path, tmpPath: tmpPath}, nil
+	}
+
+	return createInPlace(path)
+}
+
+func createInPlace(path string) (*AtomicFile, error) {
+	open := func() (*os.File, error) {
+		return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
+	}
+
+	file, err := open()
+	if errors.Is(err, syscall.ETXTBSY) {
+		// The target is a running executable. Unlinking it leaves the
+		// running image intact and lets us create a fresh file.
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		file, err = open()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+func (a *AtomicFile) Commit() error {
+	// Without a sync, a crash soon after the rename can leave the
+	// target empty or truncated.
+	if a.tmpPath != "" {
+		if err := a.File.Sync(); err != nil {
+			a.Abort()
+			return err
+		}
+	}
+
+	if err := a.File.Close(); err != nil {
+		a.Abort()
+		return err
+	}
+
+	if a.tmpPath == "" {
+		return nil
+	}
+
+	if err := os.Rename(a.tmpPath, a.path); err != nil {
+		a.Abort()
+		return err
+	}
+	a.tmpPath = ""
+	return nil
+}
+
+// Abort discards the output. The target is left untouched unless it was
+// being written in place.
+func (a *AtomicFile) Abort() {
+	a.File.Close()
+	if a.tmpPath != "" {
+		os.Remove(a.tmpPath)
+		a.tmpPath = ""
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import "sync"
+
+const numShards = 64
+
+type shard[T any] struct {
+	mu sync.Mutex
+	m  map[string]*T
+}
+
+// ConcurrentMap is a string-keyed map that can be populated from many
+// goroutines at once. Keys are spread over independently locked shards.
+type ConcurrentMap[T any] struct {
+	shards [numShards]shard[T]
+}
+
+func NewConcurrentMap[T any]() *ConcurrentMap[T] {
+	m := &ConcurrentMap[T]{}
+	for i := range m.shards {
+		m.shards[i].m = make(map[string]*T)
+	}
+	return m
+}
+
+func (m *ConcurrentMap[T]) getShard(key string) *shard[T] {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &m.shards[h%numShards]
+}
+
+func (m *ConcurrentMap[T]) Get(key string) (*T, bool) {
+	s := m.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.m[key]
+	return val, ok
+}
+
+// GetOrInsert returns the value for key, calling create to make one if
+// the key is not present yet. The boolean result reports whether the
+// value was newly created.
+func (m *ConcurrentMap[T]) GetOrInsert(key string, create func() *T) (*T, bool) {
+	s := m.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if val, ok := s.m[key]; ok {
+		return val, false
+	}
+	val := create()
+	s.m[key] = val
+	return val, true
+}
+
+func (m *ConcurrentMap[T]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		n += len(s.m)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// ForEach visits every entry. The iteration order is unspecified.
+func (m *ConcurrentMap[T]) ForEach(fn func(key string, val *T)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		for key, val := range s.m {
+			fn(key, val)
+		}
+		s.mu.Unlock()
+	}
+}
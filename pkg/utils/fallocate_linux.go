@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// Fallocate reserves size bytes of disk space for file and extends it to
+// that size, so running out of space is reported up front instead of as
+// a SIGBUS while writing through a memory mapping.
+func Fallocate(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return file.Truncate(size)
+	}
+	return err
+}
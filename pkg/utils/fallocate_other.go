@@ -0,0 +1,9 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+func Fallocate(file *os.File, size int64) error {
+	return file.Truncate(size)
+}
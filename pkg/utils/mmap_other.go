@@ -0,0 +1,18 @@
+//go:build !unix
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+const CanMmap = false
+
+func Mmap(file *os.File, size int, shared bool) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func Munmap(data []byte) error {
+	return nil
+}
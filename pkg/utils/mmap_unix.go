@@ -0,0 +1,25 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+const CanMmap = true
+
+// Mmap maps the first size bytes of file. Shared mappings write through
+// to the file; private ones are copy-on-write.
+func Mmap(file *os.File, size int, shared bool) ([]byte, error) {
+	prot := syscall.PROT_READ | syscall.PROT_WRITE
+	flags := syscall.MAP_PRIVATE
+	if shared {
+		flags = syscall.MAP_SHARED
+	}
+	return syscall.Mmap(int(file.Fd()), 0, size, prot, flags)
+}
+
+func Munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
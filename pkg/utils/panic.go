@@ -0,0 +1,14 @@
+package utils
+
+import "fmt"
+
+// Panic is what ParallelFor re-raises when a worker panics. It keeps the
+// stack of the worker, which is lost once the panic crosses goroutines.
+type Panic struct {
+	Value any
+	Stack []byte
+}
+
+func (p *Panic) String() string {
+	return fmt.Sprint(p.Value)
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// ParallelFor calls fn(i) for every i in [0, n) using at most threads
+// goroutines. A panic in any call is re-raised in the caller as a *Panic
+// once all workers have stopped; if several calls panic, the one with
+// the lowest index wins so that failures are reported deterministically.
+func ParallelFor(threads int, n int, fn func(i int)) {
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	if threads > n {
+		threads = n
+	}
+
+	if threads <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var (
+		mu       sync.Mutex
+		next     int
+		panicIdx = n
+		panicVal *Panic
+		wg       sync.WaitGroup
+	)
+
+	worker := func() {
+		defer wg.Done()
+		for {
+			mu.Lock()
+			i := next
+			next++
+			stop := i >= n || panicIdx < n
+			mu.Unlock()
+			if stop {
+				return
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						mu.Lock()
+						if i < panicIdx {
+							panicIdx = i
+							panicVal = &Panic{Value: r, Stack: debug.Stack()}
+						}
+						mu.Unlock()
+					}
+				}()
+				fn(i)
+			}()
+		}
+	}
+
+	wg.Add(threads)
+	for t := 0; t < threads; t++ {
+		go worker()
+	}
+	wg.Wait()
+
+	if panicIdx < n {
+		panic(panicVal)
+	}
+}
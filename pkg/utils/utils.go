@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math/bits"
 	"os"
 	"runtime/debug"
 	"strings"
+	"unsafe"
 )
 
 func Fatal(v any) {
@@ -16,6 +18,10 @@ func Fatal(v any) {
 	os.Exit(1)
 }
 
+func Warn(v any) {
+	fmt.Fprintf(os.Stderr, "rvld: \033[0;1;35mwarning:\033[0m %v\n", v)
+}
+
 func MustNo(err error) {
 	if err != nil {
 		Fatal(err)
@@ -28,15 +34,51 @@ func Assert(condition bool) {
 	}
 }
 
+// HostIsLittleEndian reports whether in-memory integers have the same
+// byte order as RISC-V ELF files, in which case ELF structures can be
+// accessed in place instead of being decoded field by field.
+var HostIsLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+func asBytes[T any](val *T) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(val)), unsafe.Sizeof(*val))
+}
+
+// Read decodes a little-endian T from data. T must have no padding, or
+// the in-place copy and the encoding/binary fallback would disagree.
 func Read[T any](data []byte) (val T) {
-	reader := bytes.NewReader(data)
-	err := binary.Read(reader, binary.LittleEndian, &val)
-	MustNo(err)
+	if !HostIsLittleEndian {
+		reader := bytes.NewReader(data)
+		if err := binary.Read(reader, binary.LittleEndian, &val); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if len(data) < int(unsafe.Sizeof(val)) {
+		panic(io.ErrUnexpectedEOF)
+	}
+	copy(asBytes(&val), data)
 	return
 }
 
+// ReadSlice returns the contents of data as a slice of T. When the host
+// byte order and the alignment of data allow it, the result aliases data
+// instead of being a copy.
 func ReadSlice[T any](data []byte, sz int) []T {
 	nums := len(data) / sz
+	if nums == 0 {
+		return []T{}
+	}
+
+	var zero T
+	if HostIsLittleEndian && sz == int(unsafe.Sizeof(zero)) &&
+		uintptr(unsafe.Pointer(&data[0]))%unsafe.Alignof(zero) == 0 {
+		return unsafe.Slice((*T)(unsafe.Pointer(&data[0])), nums)
+	}
+
 	res := make([]T, 0, nums)
 	for nums > 0 {
 		res = append(res, Read[T](data))
@@ -48,10 +90,27 @@ func ReadSlice[T any](data []byte, sz int) []T {
 }
 
 func Write[T any](data []byte, e T) {
-	buf := &bytes.Buffer{}
-	err := binary.Write(buf, binary.LittleEndian, e)
-	MustNo(err)
-	copy(data, buf.Bytes())
+	if !HostIsLittleEndian {
+		buf := &bytes.Buffer{}
+		if err := binary.Write(buf, binary.LittleEndian, e); err != nil {
+			panic(err)
+		}
+		copy(data, buf.Bytes())
+		return
+	}
+
+	if len(data) < int(unsafe.Sizeof(e)) {
+		panic(io.ErrShortBuffer)
+	}
+	copy(data, asBytes(&e))
+}
+
+func WriteSlice[T any](data []byte, elems []T) {
+	var zero T
+	sz := int(unsafe.Sizeof(zero))
+	for i := range elems {
+		Write(data[i*sz:], elems[i])
+	}
 }
 
 func RemovePrefix(s, prefix string) (string, bool) {
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// sym has the layout of an Elf64_Sym.
+type sym struct {
+	Name  uint32
+	Info  uint8
+	Other uint8
+	Shndx uint16
+	Val   uint64
+	Size  uint64
+}
+
+// alignedBytes returns n zero bytes aligned like a uint64, as the
+// contents of an mmap'd file are.
+func alignedBytes(n int) []byte {
+	buf := make([]uint64, (n+7)/8)
+	return unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), n)
+}
+
+// benchDecoders runs fn both in place and through encoding/binary,
+// which is how every structure used to be decoded, so the two can be
+// compared side by side.
+func benchDecoders(b *testing.B, fn func(b *testing.B)) {
+	if !HostIsLittleEndian {
+		b.Skip("in-place access needs a little-endian host")
+	}
+
+	b.Run("binary", func(b *testing.B) {
+		HostIsLittleEndian = false
+		defer func() { HostIsLittleEndian = true }()
+		fn(b)
+	})
+	b.Run("in-place", fn)
+}
+
+func BenchmarkRead(b *testing.B) {
+	benchDecoders(b, func(b *testing.B) {
+		data := alignedBytes(24)
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			Read[sym](data)
+		}
+	})
+}
+
+func BenchmarkReadSlice(b *testing.B) {
+	benchDecoders(b, func(b *testing.B) {
+		data := alignedBytes(1024 * 24)
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			ReadSlice[sym](data, 24)
+		}
+	})
+}
+
+func BenchmarkWrite(b *testing.B) {
+	benchDecoders(b, func(b *testing.B) {
+		data := alignedBytes(24)
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			Write(data, sym{Val: uint64(i)})
+		}
+	})
+}
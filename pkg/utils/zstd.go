@@ -0,0 +1,25 @@
+//go:build zstd
+
+package utils
+
+import "github.com/klauspost/compress/zstd"
+
+const CanZstd = true
+
+func ZstdDecompress(data []byte, size uint64) ([]byte, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return dec.DecodeAll(data, make([]byte, 0, size))
+}
+
+func ZstdCompress(data []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil), nil
+}
@@ -0,0 +1,15 @@
+//go:build !zstd
+
+package utils
+
+import "errors"
+
+const CanZstd = false
+
+func ZstdDecompress(data []byte, size uint64) ([]byte, error) {
+	return nil, errors.New("zstd support is not compiled in")
+}
+
+func ZstdCompress(data []byte) ([]byte, error) {
+	return nil, errors.New("zstd support is not compiled in")
+}
@@ -1,164 +1,397 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ksco/rvld/pkg/linker"
 	"github.com/ksco/rvld/pkg/utils"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 var version string
 
 func main() {
-	ctx := linker.NewContext()
-	remaining := parseArgs(ctx)
+	cfg := parseArgs(os.Args[1:])
 
-	if ctx.Args.Emulation == linker.MachineTypeNone {
-		for _, filename := range remaining {
-			if strings.HasPrefix(filename, "-") {
-				continue
-			}
+	out, err := utils.CreateAtomicFile(cfg.Args.Output)
+	utils.MustNo(err)
 
-			file := linker.MustNewFile(filename)
-			ctx.Args.Emulation =
-				linker.GetMachineTypeFromContents(file.Contents)
-			if ctx.Args.Emulation != linker.MachineTypeNone {
-				break
-			}
+	var mapFile *utils.AtomicFile
+	if cfg.Args.MapFile != "" {
+		mapFile, err = utils.CreateAtomicFile(cfg.Args.MapFile)
+		if err != nil {
+			out.Abort()
+			utils.Fatal(err)
 		}
+		cfg.MapFile = mapFile.File
 	}
 
-	if ctx.Args.Emulation != linker.MachineTypeRISCV64 {
-		utils.Fatal("unknown emulation type")
-	}
-
-	linker.ReadInputFiles(ctx, remaining)
-	linker.ResolveSymbols(ctx)
-	linker.RegisterSectionPieces(ctx)
-	linker.ComputeMergedSectionSizes(ctx)
-	linker.CreateSyntheticSections(ctx)
-	linker.BinSections(ctx)
-	ctx.Chunks = append(ctx.Chunks, linker.CollectOutputSections(ctx)...)
-	linker.ScanRelocations(ctx)
-	linker.ComputeSectionSizes(ctx)
-	linker.SortOutputSections(ctx)
-
-	for _, chunk := range ctx.Chunks {
-		chunk.UpdateShdr(ctx)
+	abort := func() {
+		out.Abort()
+		if mapFile != nil {
+			mapFile.Abort()
+		}
 	}
 
-	fileSize := linker.SetOutputSectionOffsets(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		abort()
+		os.Exit(1)
+	}()
 
-	ctx.Buf = make([]byte, fileSize)
+	cfg.Output = out.File
+	cfg.Stdout = os.Stdout
 
-	file, err := os.OpenFile(ctx.Args.Output, os.O_RDWR|os.O_CREATE, 0777)
-	utils.MustNo(err)
+	res, err := linker.Link(context.Background(), cfg)
+	if err != nil {
+		abort()
+		var linkErr *linker.LinkError
+		if errors.As(err, &linkErr) && linkErr.Stack != nil {
+			os.Stderr.Write(linkErr.Stack)
+		}
+		utils.Fatal(err)
+	}
 
-	for _, chunk := range ctx.Chunks {
-		chunk.CopyBuf(ctx)
+	for _, w := range res.Warnings {
+		utils.Warn(w)
 	}
 
-	_, err = file.Write(ctx.Buf)
-	utils.MustNo(err)
+	utils.MustNo(out.Commit())
+	if mapFile != nil {
+		utils.MustNo(mapFile.Commit())
+	}
 }
 
-func parseArgs(ctx *linker.Context) []string {
-	args := os.Args[1:]
+func parseArgs(args []string) linker.Config {
+	cfg := linker.Config{Args: linker.NewContextArgs()}
 
-	dashes := func(name string) []string {
-		if len(name) == 1 {
-			return []string{"-" + name}
-		}
-		return []string{"-" + name, "--" + name}
+	// -Bstatic and --as-needed apply to the inputs that follow them, and
+	// --push-state and --pop-state save and restore both.
+	type inputState struct {
+		static   bool
+		asNeeded bool
 	}
+	state := inputState{}
+	stack := make([]inputState, 0)
 
-	arg := ""
-	readArg := func(name string) bool {
-		for _, opt := range dashes(name) {
-			if args[0] == opt {
-				if len(args) == 1 {
-					utils.Fatal(fmt.Sprintf("option -%s: argument missing", name))
-				}
+	addInput := func(name string) {
+		cfg.Inputs = append(cfg.Inputs, linker.Input{
+			Name:     name,
+			Static:   state.static,
+			AsNeeded: state.asNeeded,
+		})
+	}
 
-				arg = args[1]
-				args = args[2:]
-				return true
-			}
+	zFlags := map[string]func(){
+		"execstack": func() {
+			cfg.Args.ZExecStack, cfg.Args.ZNoExecStack = true, false
+		},
+		"noexecstack": func() {
+			cfg.Args.ZExecStack, cfg.Args.ZNoExecStack = false, true
+		},
+		"relro":           func() { cfg.Args.ZRelro = true },
+		"norelro":         func() { cfg.Args.ZRelro = false },
+		"separate-code":   func() { cfg.Args.ZSeparateCode = true },
+		"noseparate-code": func() { cfg.Args.ZSeparateCode = false },
 
-			prefix := opt
-			if len(name) > 1 {
-				prefix += "="
-			}
-			if strings.HasPrefix(args[0], prefix) {
-				arg = args[0][len(prefix):]
-				args = args[1:]
-				return true
-			}
-		}
+		// There is no PLT to bind lazily in a static executable.
+		"now":  func() {},
+		"lazy": func() {},
+	}
 
-		return false
+	zArgs := map[string]func(arg, val string){
+		"max-page-size": func(arg, val string) {
+			cfg.Args.MaxPageSize = parsePageSize(arg, val)
+		},
+		"common-page-size": func(arg, val string) {
+			cfg.Args.CommonPageSize = parsePageSize(arg, val)
+		},
 	}
 
-	readFlag := func(name string) bool {
-		for _, opt := range dashes(name) {
-			if args[0] == opt {
-				args = args[1:]
-				return true
-			}
-		}
+	ignore := func(string) {}
 
-		return false
+	// unsupported options still take their argument, so that it isn't
+	// read as an input file.
+	unsupported := func(names ...string) option {
+		return option{names: names, hasArg: true, fn: func(arg string) {
+			utils.Warn(fmt.Sprintf("-%s %s: option is not supported and is ignored",
+				names[0], arg))
+		}}
 	}
 
-	remaining := make([]string, 0)
-	for len(args) > 0 {
-		if readFlag("help") {
+	table := []option{
+		{names: []string{"help"}, fn: func(string) {
 			fmt.Printf("usage: %s [options] file...\n", os.Args[0])
 			os.Exit(0)
-		}
-
-		if readArg("o") || readArg("output") {
-			ctx.Args.Output = arg
-		} else if readFlag("v") || readFlag("version") {
+		}},
+		{names: []string{"v", "version"}, fn: func(string) {
 			fmt.Printf("rvld %s\n", version)
 			os.Exit(0)
-		} else if readArg("m") {
-			if arg == "elf64lriscv" {
-				ctx.Args.Emulation = linker.MachineTypeRISCV64
-			} else {
+		}},
+		{names: []string{"o", "output"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.Output = arg
+		}},
+		{names: []string{"m"}, hasArg: true, fn: func(arg string) {
+			switch arg {
+			case "elf64lriscv":
+				cfg.Args.Emulation = linker.MachineTypeRISCV64
+			case "elf32lriscv":
+				cfg.Args.Emulation = linker.MachineTypeRISCV32
+			case "elf_x86_64":
+				cfg.Args.Emulation = linker.MachineTypeX86_64
+			default:
 				utils.Fatal(fmt.Sprintf("unknown -m argument: %s", arg))
 			}
-		} else if readArg("L") {
-			ctx.Args.LibraryPaths = append(ctx.Args.LibraryPaths, arg)
-		} else if readArg("l") {
-			remaining = append(remaining, "-l"+arg)
-		} else if readArg("sysroot") ||
-			readFlag("static") ||
-			readArg("plugin") ||
-			readArg("plugin-opt") ||
-			readFlag("as-needed") ||
-			readFlag("start-group") ||
-			readFlag("end-group") ||
-			readArg("hash-style") ||
-			readArg("build-id") ||
-			readFlag("s") ||
-			readFlag("no-relax") {
-			// Ignored
-		} else {
-			if args[0][0] == '-' {
+		}},
+		{names: []string{"oformat"}, hasArg: true, fn: func(arg string) {
+			format, ok := linker.GetOutputFormatFromName(arg)
+			if !ok {
+				utils.Fatal(fmt.Sprintf("unknown --oformat argument: %s", arg))
+			}
+			cfg.Args.OFormat = format
+		}},
+		{names: []string{"gap-fill"}, hasArg: true, fn: func(arg string) {
+			val, err := strconv.ParseUint(arg, 0, 8)
+			if err != nil {
+				utils.Fatal(fmt.Sprintf("invalid --gap-fill argument: %s", arg))
+			}
+			cfg.Args.GapFill = uint8(val)
+		}},
+		{names: []string{"Map"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.MapFile = arg
+		}},
+		{names: []string{"M", "print-map"}, fn: func(string) {
+			cfg.Args.PrintMap = true
+		}},
+		{names: []string{"cref"}, fn: func(string) {
+			cfg.Args.Cref = true
+		}},
+		{names: []string{"trace-symbol", "y"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.TraceSymbols = append(cfg.Args.TraceSymbols, arg)
+		}},
+		{names: []string{"wrap"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.Wrap = append(cfg.Args.Wrap, arg)
+		}},
+		{names: []string{"defsym"}, hasArg: true, fn: func(arg string) {
+			defsym, ok := linker.ParseDefsym(arg)
+			if !ok {
+				utils.Fatal(fmt.Sprintf("invalid --defsym argument: %s", arg))
+			}
+			cfg.Args.Defsyms = append(cfg.Args.Defsyms, defsym)
+		}},
+		{names: []string{"threads"}, hasArg: true, fn: func(arg string) {
+			threads, err := strconv.Atoi(arg)
+			if err != nil || threads < 1 {
+				utils.Fatal(fmt.Sprintf("invalid --threads argument: %s", arg))
+			}
+			cfg.Args.Threads = threads
+		}},
+		{names: []string{"no-threads"}, fn: func(string) {
+			cfg.Args.Threads = 1
+		}},
+		{names: []string{"build-id"}, fn: func(string) {
+			cfg.Args.BuildId = linker.BuildId{Kind: linker.BuildIdKindSha1}
+		}},
+		{names: []string{"build-id"}, hasArg: true, fn: func(arg string) {
+			buildId, ok := linker.ParseBuildId(arg)
+			if !ok {
+				utils.Fatal(fmt.Sprintf("invalid --build-id argument: %s", arg))
+			}
+			cfg.Args.BuildId = buildId
+		}},
+		{names: []string{"r", "relocatable"}, fn: func(string) {
+			cfg.Args.Relocatable = true
+		}},
+		{names: []string{"q", "emit-relocs"}, fn: func(string) {
+			cfg.Args.EmitRelocs = true
+		}},
+		{names: []string{"icf"}, hasArg: true, fn: func(arg string) {
+			mode, ok := linker.ParseIcfMode(arg)
+			if !ok {
+				utils.Fatal(fmt.Sprintf("unknown --icf argument: %s", arg))
+			}
+			cfg.Args.Icf = mode
+		}},
+		{names: []string{"gdb-index"}, fn: func(string) {
+			cfg.Args.GdbIndex = true
+		}},
+		{names: []string{"S", "strip-debug"}, fn: func(string) {
+			cfg.Args.StripDebug = true
+		}},
+		{names: []string{"compress-debug-sections"}, hasArg: true, fn: func(arg string) {
+			typ, ok := linker.ParseCompressionType(arg)
+			if !ok {
 				utils.Fatal(fmt.Sprintf(
-					"unknown command line option: %s", args[0]))
+					"unknown --compress-debug-sections argument: %s", arg))
 			}
-			remaining = append(remaining, args[0])
-			args = args[1:]
-		}
+			cfg.Args.CompressDebugSections = typ
+		}},
+		{names: []string{"print-icf-sections"}, fn: func(string) {
+			cfg.Args.PrintIcfSections = true
+		}},
+		{names: []string{"symbol-ordering-file"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.SymbolOrderingFile = arg
+		}},
+		{names: []string{"section-ordering-file"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.SectionOrderingFile = arg
+		}},
+		{names: []string{"version-script"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.VersionScript = arg
+		}},
+		{names: []string{"sort-section"}, hasArg: true, fn: func(arg string) {
+			kind, ok := linker.ParseSortSection(arg)
+			if !ok {
+				utils.Fatal(fmt.Sprintf("unknown --sort-section argument: %s", arg))
+			}
+			cfg.Args.SortSection = kind
+		}},
+		{names: []string{"z"}, hasArg: true, fn: func(arg string) {
+			if fn, ok := zFlags[arg]; ok {
+				fn()
+				return
+			}
+			if key, val, ok := strings.Cut(arg, "="); ok {
+				if fn, ok := zArgs[key]; ok {
+					fn(arg, val)
+					return
+				}
+			}
+			utils.Warn(fmt.Sprintf("unknown -z option: %s", arg))
+		}},
+		{names: []string{"L", "library-path"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.LibraryPaths = append(cfg.Args.LibraryPaths, arg)
+		}},
+		{names: []string{"l", "library"}, hasArg: true, fn: func(arg string) {
+			addInput("-l" + arg)
+		}},
+		{names: []string{"sysroot"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.Sysroot = arg
+		}},
+		{names: []string{"nostdlib"}, fn: func(string) {
+			cfg.Args.NoStdlib = true
+		}},
+		{names: []string{"Bstatic", "static", "dn", "non_shared"}, fn: func(string) {
+			state.static = true
+		}},
+		{names: []string{"Bdynamic", "dy", "call_shared"}, fn: func(string) {
+			state.static = false
+		}},
+		{names: []string{"as-needed"}, fn: func(string) {
+			state.asNeeded = true
+		}},
+		{names: []string{"no-as-needed"}, fn: func(string) {
+			state.asNeeded = false
+		}},
+		{names: []string{"push-state"}, fn: func(string) {
+			stack = append(stack, state)
+		}},
+		{names: []string{"pop-state"}, fn: func(string) {
+			if len(stack) == 0 {
+				utils.Fatal("--pop-state without --push-state")
+			}
+			state, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		}},
+
+		{names: []string{"E", "export-dynamic"}, fn: func(string) {
+			cfg.Args.ExportDynamic = true
+		}},
+		{names: []string{"no-export-dynamic"}, fn: func(string) {
+			cfg.Args.ExportDynamic = false
+		}},
+		{names: []string{"dynamic-list"}, hasArg: true, fn: func(arg string) {
+			cfg.Args.DynamicLists = append(cfg.Args.DynamicLists, arg)
+		}},
+		{names: []string{"Bsymbolic"}, fn: func(string) {
+			cfg.Args.Bsymbolic = true
+		}},
+
+		// References in an executable already bind to its own
+		// definitions, and unlike -Bsymbolic this sets no flag.
+		{names: []string{"Bsymbolic-functions"}, fn: ignore},
+
+		{names: []string{"pie", "pic-executable"}, fn: func(string) {
+			utils.Warn("-pie is not supported; " +
+				"creating a position-dependent executable")
+		}},
+		unsupported("T", "script"),
+		unsupported("e", "entry"),
+		unsupported("u", "undefined"),
+		unsupported("Ttext"),
+		unsupported("Tdata"),
+		unsupported("Tbss"),
+		unsupported("Ttext-segment"),
+		unsupported("section-start"),
+		unsupported("R", "just-symbols"),
+		unsupported("init"),
+		unsupported("fini"),
+
+		// Other GNU ld options with an argument, listed so that the
+		// argument is skipped and a single-dash spelling such as
+		// -export-dynamic-symbol isn't taken for -e xport-dynamic-symbol.
+		unsupported("A", "architecture"),
+		unsupported("b", "format"),
+		unsupported("c", "mri-script"),
+		unsupported("f", "auxiliary"),
+		unsupported("F", "filter"),
+		unsupported("G", "gpsize"),
+		unsupported("P", "depaudit"),
+		unsupported("Y"),
+		unsupported("assert"),
+		unsupported("audit"),
+		unsupported("default-script", "dT"),
+		unsupported("dependency-file"),
+		unsupported("error-handling-script"),
+		unsupported("exclude-libs"),
+		unsupported("export-dynamic-symbol"),
+		unsupported("export-dynamic-symbol-list"),
+		unsupported("ignore-unresolved-symbol"),
+		unsupported("orphan-handling"),
+		unsupported("out-implib"),
+		unsupported("require-defined"),
+		unsupported("retain-symbols-file"),
+		unsupported("spare-dynamic-tags"),
+		unsupported("task-link"),
+		unsupported("Tldata-segment"),
+		unsupported("Trodata-segment"),
+		unsupported("version-exports-section"),
+
+		// Ignored
+		{names: []string{"s", "strip-all", "start-group", "end-group",
+			"(", ")", "no-relax", "relax", "eh-frame-hdr",
+			"no-eh-frame-hdr", "EL", "no-pie", "X",
+			"discard-locals", "x", "discard-all", "no-add-needed",
+			"add-needed", "no-copy-dt-needed-entries",
+			"copy-dt-needed-entries", "fatal-warnings",
+			"no-fatal-warnings"}, fn: ignore},
+		{names: []string{"plugin", "plugin-opt", "hash-style", "O",
+			"dynamic-linker", "I", "rpath", "rpath-link", "soname", "h"},
+			hasArg: true, fn: ignore},
 	}
 
-	for i, path := range ctx.Args.LibraryPaths {
-		ctx.Args.LibraryPaths[i] = filepath.Clean(path)
+	args = expandResponseFiles(args)
+	parseOptions(args, table, addInput, func(arg string) {
+		utils.Warn(fmt.Sprintf("unknown command line option: %s", arg))
+	})
+
+	for i, path := range cfg.Args.LibraryPaths {
+		cfg.Args.LibraryPaths[i] = filepath.Clean(path)
 	}
 
-	return remaining
+	return cfg
+}
+
+func parsePageSize(arg, val string) uint64 {
+	size, err := strconv.ParseUint(val, 0, 64)
+	if err != nil || size == 0 || size&(size-1) != 0 {
+		utils.Fatal(fmt.Sprintf("invalid -z argument: %s", arg))
+	}
+	return size
 }
@@ -0,0 +1,68 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+asm() {
+	(cat; echo '.section .note.GNU-stack,"",@progbits') |
+		$MC -triple=riscv64 -filetype=obj -o "$t/$1" -
+}
+
+echo '.globl _start; _start: ret' | asm small.o
+cat <<'EOF2' | asm big.o
+	.globl _start
+_start:
+	ret
+	.data
+	.fill 65536, 1, 0xff
+EOF2
+
+temps() {
+	find "$t" /dev -maxdepth 1 -name '.*.tmp*'
+}
+
+./rvld "$t"/small.o -o "$t"/small
+./rvld "$t"/big.o -o "$t"/out
+[ -x "$t"/out ]
+cp "$t"/out "$t"/old
+
+# A failed link leaves the old output alone and cleans up after itself.
+if ./rvld "$t"/small.o -lmissing -o "$t"/out > "$t"/log 2>&1; then
+	exit 1
+fi
+grep -q 'library not found' "$t"/log
+cmp "$t"/old "$t"/out
+[ -z "$(temps)" ]
+
+# A smaller output replaces a larger one completely.
+./rvld "$t"/small.o -o "$t"/out
+cmp "$t"/small "$t"/out
+[ -z "$(temps)" ]
+
+# The output may be an executable that is running.
+cat <<'EOF2' | as -o "$t"/pause.o -
+	.globl _start
+_start:
+	movl $34, %eax
+	syscall
+	jmp _start
+	.section .note.GNU-stack,"",@progbits
+EOF2
+./rvld -m elf_x86_64 "$t"/pause.o -o "$t"/pause
+"$t"/pause &
+pid=$!
+./rvld -m elf_x86_64 "$t"/pause.o -o "$t"/pause
+kill $pid
+wait $pid || true
+[ -z "$(temps)" ]
+
+# Devices are written in place rather than replaced.
+./rvld "$t"/small.o -o /dev/null
+[ -c /dev/null ]
+[ -z "$(temps)" ]
@@ -0,0 +1,91 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+for i in 1 2; do
+	cat <<EOF2 | $MC -triple=riscv64 -filetype=obj -o "$t/a$i.o" -
+	.globl _start
+_start:
+	li a0, $i
+	ret
+	.section .note.GNU-stack,"",@progbits
+EOF2
+done
+
+build_id() {
+	llvm-readelf -n "$1" | awk '/Build ID:/ { print $3 }'
+}
+
+# Recomputes a build ID over the file with the descriptor zeroed.
+hash() {
+	python3 - "$1" "$2" <<'EOF2'
+import hashlib, struct, sys
+
+kind, path = sys.argv[1], sys.argv[2]
+data = bytearray(open(path, 'rb').read())
+shoff, = struct.unpack_from('<Q', data, 0x28)
+shentsize, shnum = struct.unpack_from('<HH', data, 0x3a)
+for i in range(shnum):
+	typ, = struct.unpack_from('<I', data, shoff + i * shentsize + 4)
+	off, = struct.unpack_from('<Q', data, shoff + i * shentsize + 0x18)
+	if typ == 7:  # SHT_NOTE
+		size, = struct.unpack_from('<I', data, off + 4)
+		data[off + 16:off + 16 + size] = bytes(size)
+
+if kind == 'fast':
+	shards = [data[i:i + (1 << 20)] for i in range(0, len(data), 1 << 20)]
+	digest = hashlib.sha256(b''.join(
+		hashlib.sha256(s).digest() for s in shards)).hexdigest()[:32]
+else:
+	digest = hashlib.new(kind, data).hexdigest()
+print(digest)
+EOF2
+}
+
+./rvld --build-id "$t"/a1.o -o "$t"/sha1
+id=$(build_id "$t"/sha1)
+[ ${#id} -eq 40 ]
+[ "$id" = "$(hash sha1 "$t"/sha1)" ]
+llvm-readelf -lW "$t"/sha1 | grep -q NOTE
+
+# A build ID identifies the contents: the same link gives the same
+# ID, and different inputs a different one.
+./rvld --build-id=sha1 "$t"/a1.o -o "$t"/sha1-again
+cmp "$t"/sha1 "$t"/sha1-again
+./rvld --build-id=sha1 "$t"/a2.o -o "$t"/sha1-other
+[ "$id" != "$(build_id "$t"/sha1-other)" ]
+
+./rvld --build-id=md5 "$t"/a1.o -o "$t"/md5
+[ "$(build_id "$t"/md5)" = "$(hash md5 "$t"/md5)" ]
+
+./rvld --build-id=fast "$t"/a1.o -o "$t"/fast
+[ "$(build_id "$t"/fast)" = "$(hash fast "$t"/fast)" ]
+
+# A UUID is random, with the bits of a version 4 UUID.
+./rvld --build-id=uuid "$t"/a1.o -o "$t"/uuid1
+./rvld --build-id=uuid "$t"/a1.o -o "$t"/uuid2
+uuid=$(build_id "$t"/uuid1)
+[ ${#uuid} -eq 32 ]
+[ "$uuid" != "$(build_id "$t"/uuid2)" ]
+[ "${uuid:12:1}" = 4 ]
+[[ ${uuid:16:1} == [89ab] ]]
+
+./rvld --build-id=0xDEADbeef01 "$t"/a1.o -o "$t"/hex
+[ "$(build_id "$t"/hex)" = deadbeef01 ]
+
+./rvld --build-id=none "$t"/a1.o -o "$t"/none
+if llvm-readelf -SW "$t"/none | grep -q build-id; then
+	exit 1
+fi
+
+if ./rvld --build-id=0xzz "$t"/a1.o -o "$t"/bad > "$t"/log 2>&1; then
+	exit 1
+fi
+grep -q 'invalid --build-id argument: 0xzz' "$t"/log
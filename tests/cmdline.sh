@@ -0,0 +1,83 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t" "$t/with space"
+
+cat <<'EOF2' | as -o "$t/with space/a.o" -
+	.text
+	.globl _start
+_start:
+	call get
+	movq %rax, %rdi
+	movq $60, %rax
+	syscall
+EOF2
+
+cat <<'EOF2' | as -o "$t/with space/b.o" -
+	.text
+	.globl get
+get:
+	movq $9, %rax
+	ret
+EOF2
+
+# Response files nest, and quotes and backslashes group words the way
+# gcc writes them.
+cat <<EOF2 > "$t"/inner.rsp
+-z max-page-size=0x10000 -znow
+'$t/with space/a.o'
+EOF2
+
+cat <<EOF2 > "$t"/outer.rsp
+-m elf_x86_64 --push-state -Bstatic --as-needed --pop-state
+@$t/inner.rsp
+-o "$t/with space/out" --frobnicate -z frob=1 -EL --eh-frame-hdr
+$t/with\\ space/b.o
+EOF2
+
+./rvld @"$t"/outer.rsp 2> "$t"/log
+grep -q 'unknown command line option: --frobnicate' "$t"/log
+grep -q 'unknown -z option: frob=1' "$t"/log
+
+set +e
+"$t/with space/out"
+status=$?
+set -e
+[ $status -eq 9 ]
+readelf -lW "$t/with space/out" | grep -q 'LOAD .* 0x10000$'
+
+# A response file that can't be read is taken as a file name.
+./rvld -m elf_x86_64 @"$t"/missing -o "$t"/out > "$t"/log 2>&1 && exit 1
+grep -q "$t/missing" "$t"/log
+
+./rvld -m elf_x86_64 --pop-state "$t/with space/a.o" -o "$t"/out \
+	> "$t"/log 2>&1 && exit 1
+grep -q -- '--pop-state without --push-state' "$t"/log
+
+# gcc passes options of its own to the linker.
+ln -sf "$PWD"/rvld "$t"/ld
+gcc -B"$t"/ -nostdlib -static "$t/with space/a.o" "$t/with space/b.o" \
+	-o "$t"/gcc-out
+set +e
+"$t"/gcc-out
+status=$?
+set -e
+[ $status -eq 9 ]
+
+# Options that take an argument consume it even when rvld doesn't
+# support them, so the argument is never read as an input file.
+./rvld -m elf_x86_64 "$t/with space/a.o" "$t/with space/b.o" -o "$t"/out \
+	-rpath /nonexistent -soname libx.so -T missing.ld -e main \
+	-u missing -Ttext=0x1000 -pie 2> "$t"/log
+grep -q -- '-T missing.ld: option is not supported' "$t"/log
+grep -q -- '-e main: option is not supported' "$t"/log
+grep -q -- '-u missing: option is not supported' "$t"/log
+grep -q -- '-Ttext 0x1000: option is not supported' "$t"/log
+grep -q -- '-pie is not supported' "$t"/log
+if grep -q 'nonexistent\|libx.so' "$t"/log; then
+	exit 1
+fi
@@ -0,0 +1,47 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+mkdir -p "$t"
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	ret
+
+	.section .data.foo,"awG",@progbits,foo,comdat
+	.globl foo
+foo:
+	.quad 0x1111
+
+	.section .data.bar,"awG",@progbits,bar
+	.quad 0x3333
+EOF2
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/b.o -
+	.section .data.foo,"awG",@progbits,foo,comdat
+	.globl foo
+foo:
+	.quad 0x2222
+	.quad 0x2222
+
+	.section .data.bar,"awG",@progbits,bar
+	.quad 0x4444
+EOF2
+
+./rvld "$t"/a.o "$t"/b.o -o "$t"/out
+
+# Only the first copy of the COMDAT group foo is kept, while both
+# members of the plain group bar are.
+od -An -tx1 -v "$t"/out | tr -d ' \n' > "$t"/bytes
+grep -q 1111000000000000 "$t"/bytes
+if grep -q 2222000000000000 "$t"/bytes; then
+	exit 1
+fi
+grep -q 3333000000000000 "$t"/bytes
+grep -q 4444000000000000 "$t"/bytes
@@ -0,0 +1,43 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF2' > "$t"/a.s
+	.text
+	.globl _start
+_start:
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+
+	.section .debug_str,"MS",@progbits,1
+	.asciz "a debug string"
+	.section .debug_info,"",@progbits
+	.fill 200, 1, 0x5a
+EOF2
+
+as "$t"/a.s -o "$t"/a.o
+as --compress-debug-sections=zlib "$t"/a.s -o "$t"/b.o
+
+dump() { readelf -x "$2" $3 "$1" | grep '^  0x'; }
+
+./rvld -m elf_x86_64 "$t"/a.o -o "$t"/plain
+./rvld -m elf_x86_64 "$t"/b.o -o "$t"/out
+if readelf -SW "$t"/out | grep -Eq '\.debug_.* C '; then
+	exit 1
+fi
+for sec in .debug_info .debug_str; do
+	[ "$(dump "$t"/out $sec)" = "$(dump "$t"/plain $sec)" ]
+done
+
+./rvld -m elf_x86_64 --compress-debug-sections=zlib "$t"/a.o -o "$t"/out2
+readelf -SW "$t"/out2 | grep -Eq '\.debug_info .* C '
+for sec in .debug_info .debug_str; do
+	[ "$(dump "$t"/out2 $sec -z)" = "$(dump "$t"/plain $sec)" ]
+done
+"$t"/out2
@@ -0,0 +1,96 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+asm() {
+	(cat; echo '.section .note.GNU-stack,"",@progbits') |
+		$MC -triple=riscv64 -filetype=obj -o "$t/$1" -
+}
+
+asm main.o <<'EOF2'
+	.globl _start
+_start:
+	call foo
+	call bar
+	ret
+EOF2
+
+asm foo.o <<'EOF2'
+	.globl foo
+foo:
+	call bar
+	ret
+EOF2
+
+asm bar.o <<'EOF2'
+	.globl bar
+bar:
+	ret
+EOF2
+
+asm unused.o <<'EOF2'
+	.globl unused
+unused:
+	ret
+EOF2
+
+asm dup.o <<'EOF2'
+	.globl bar
+bar:
+	ret
+EOF2
+
+ar rcs "$t"/lib.a "$t"/foo.o "$t"/bar.o "$t"/unused.o
+
+./rvld "$t"/main.o "$t"/lib.a -o "$t"/out --cref -y foo \
+	--trace-symbol=bar > "$t"/log
+
+# Each definition, reference and archive member pulled in is traced,
+# file by file, followed by how the symbol was resolved.
+cat <<EOF2 | diff - <(sed '/^$/,$d' "$t"/log)
+$t/main.o: reference to foo
+$t/main.o: reference to bar
+$t/main.o: reference to foo pulls in $t/lib.a(foo.o)
+$t/main.o: reference to bar pulls in $t/lib.a(bar.o)
+$t/lib.a(foo.o): definition of foo
+$t/lib.a(foo.o): reference to bar
+$t/lib.a(bar.o): definition of bar
+foo: resolved to definition in $t/lib.a(foo.o)
+bar: resolved to definition in $t/lib.a(bar.o)
+EOF2
+
+# Archive members that aren't pulled in are not part of the link.
+./rvld "$t"/main.o "$t"/lib.a -o "$t"/out -y unused > "$t"/log3
+cat <<EOF2 | diff - "$t"/log3
+unused: unresolved
+EOF2
+
+# The cross reference table lists the defining file of every global,
+# then the files referring to it. Members that were not pulled in
+# don't appear.
+sed -n '/^Cross Reference Table$/,$p' "$t"/log > "$t"/cref
+cat <<EOF2 | diff - "$t"/cref
+Cross Reference Table
+
+Symbol                                            File
+_start                                            $t/main.o
+bar                                               $t/lib.a(bar.o)
+                                                  $t/main.o
+                                                  $t/lib.a(foo.o)
+foo                                               $t/lib.a(foo.o)
+                                                  $t/main.o
+EOF2
+
+# When a symbol is defined twice, the first definition wins.
+./rvld "$t"/main.o "$t"/dup.o "$t"/foo.o "$t"/bar.o -o "$t"/out2 \
+	-y bar > "$t"/log2
+grep -q "^$t/dup.o: definition of bar$" "$t"/log2
+grep -q "^$t/bar.o: definition of bar$" "$t"/log2
+grep -q "^bar: resolved to definition in $t/dup.o$" "$t"/log2
@@ -0,0 +1,78 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+# Both files define foo in the same COMDAT group, so the second copy is
+# discarded. References to foo itself resolve to the copy that is kept,
+# but references to the discarded section have to become tombstones.
+for f in a b; do
+	cat <<EOF2 | as -o "$t"/$f.o -
+	.section .text.foo,"axG",@progbits,foo,comdat
+	.globl foo
+foo:
+.Lfoo:
+	ret
+
+	.section .debug_str,"MS",@progbits,1
+.Lshared:
+	.asciz "shared"
+.Lown:
+	.asciz "only in $f"
+
+	.section .debug_info,"",@progbits
+	.quad foo
+	.quad .Lfoo
+	.long .Lown
+	.long .Lshared
+
+	.section .debug_ranges,"",@progbits
+	.quad .text.foo
+EOF2
+done
+
+cat <<'EOF2' | as -o "$t"/c.o -
+	.text
+	.globl _start
+_start:
+	call foo
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+EOF2
+
+./rvld -m elf_x86_64 -q "$t"/c.o "$t"/a.o "$t"/b.o -o "$t"/out
+"$t"/out
+
+foo=$(readelf -sW "$t"/out | awk '$8 == "foo" { print $2 }')
+info=$(readelf -x .debug_info "$t"/out | grep '^  0x' | cut -c14-48 | tr -d ' \n')
+ranges=$(readelf -x .debug_ranges "$t"/out | grep '^  0x' | cut -c14-48 | tr -d ' \n')
+
+# The references are little-endian words; turn the address around.
+le=$(printf '%016x' 0x$foo | sed 's/../& /g' | awk '{ for (i = NF; i > 0; i--) printf "%s", $i }')
+[ "${info:0:16}" = "$le" ]
+[ "${info:16:16}" = "$le" ]
+[ "${info:48:16}" = "$le" ]
+[ "${info:64:16}" = ffffffffffffffff ]
+[ "${ranges:0:16}" = "$le" ]
+[ "${ranges:16:16}" = feffffffffffffff ]
+
+# Each string offset must point at the right string after merging.
+off() { echo $((16#${info:$1+6:2}${info:$1+4:2}${info:$1+2:2}${info:$1:2})); }
+str() {
+	readelf -p .debug_str "$t"/out |
+		sed -n "s/^ *\[ *$(printf %x "$(off $1)")\]  //p"
+}
+[ "$(str 32)" = 'only in a' ]
+[ "$(str 40)" = shared ]
+[ "$(str 80)" = 'only in b' ]
+[ "$(str 88)" = shared ]
+
+./rvld -m elf_x86_64 --strip-debug "$t"/c.o "$t"/a.o "$t"/b.o -o "$t"/out2
+if readelf -SW "$t"/out2 | grep -q '\.debug'; then
+	exit 1
+fi
@@ -0,0 +1,43 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.text
+	.globl _start, f, len
+_start:
+	call f
+	movq msg@GOTPCREL(%rip), %rsi
+	movq len(%rip), %rdx
+	movl $1, %eax
+	movl $1, %edi
+	syscall
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+
+f:
+	ret
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+msg:	.asciz "Hello, World\n"
+
+	.data
+len:	.quad 13
+EOF
+
+./rvld -m elf_x86_64 --emit-relocs "$t"/a.o -o "$t"/out
+readelf -h "$t"/out | grep -q 'EXEC (Executable file)'
+readelf -r "$t"/out > "$t"/rels
+grep -q "Relocation section '.rela.text'" "$t"/rels
+grep -Eq '^0*4[0-9a-f]+ .*R_X86_64_PC32 .* len - 4$' "$t"/rels
+grep -Eq 'R_X86_64_PLT32 .* f - 4$' "$t"/rels
+readelf -s "$t"/out | grep -q ' _start$'
+
+./rvld -m elf_x86_64 -q "$t"/a.o -o "$t"/out2
+readelf -S "$t"/out2 | grep -q '.rela.text'
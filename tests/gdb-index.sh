@@ -0,0 +1,41 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF2' | gcc -g -ggnu-pubnames -O1 -c -o "$t"/a.o -xc -
+struct point { int x, y; };
+static int helper(struct point p) { return p.x; }
+int get_y(struct point p) { return helper(p) + p.y; }
+EOF2
+
+cat <<'EOF2' | gcc -g -ggnu-pubnames -O1 -c -o "$t"/b.o -xc -
+int counter = 1;
+void _start(void) {
+	__asm__ volatile("mov $60, %eax; xor %edi, %edi; syscall");
+}
+EOF2
+
+./rvld -m elf_x86_64 -q --gdb-index "$t"/b.o "$t"/a.o -o "$t"/out
+"$t"/out
+
+readelf --debug-dump=gdb_index "$t"/out > "$t"/index
+grep -q 'Version 7' "$t"/index
+grep -Eq '^\[ *1\] 0x[0-9a-f]+ - 0x[0-9a-f]+$' "$t"/index
+
+start=$(readelf -sW "$t"/out | awk '$8 == "_start" { print $2 }')
+grep -Eq "^$start [0-9a-f]+ 0$" "$t"/index
+
+grep -q '_start: 0 \[global, function\]' "$t"/index
+grep -q 'counter: 0 \[global, variable\]' "$t"/index
+grep -q 'get_y: 1 \[global, function\]' "$t"/index
+grep -q 'helper: 1 \[static, function\]' "$t"/index
+grep -q 'point: 1 \[static, type\]' "$t"/index
+
+./rvld -m elf_x86_64 --gdb-index --compress-debug-sections=zlib \
+	"$t"/b.o "$t"/a.o -o "$t"/out2
+readelf --debug-dump=gdb_index "$t"/out2 | grep -q 'get_y: 1 \[global, function\]'
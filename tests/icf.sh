@@ -0,0 +1,110 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.section .text._start,"ax",@progbits
+	.globl _start
+_start:
+	call f
+	call g
+	call h1
+	call h2
+	ret
+
+	.section .text.f,"ax",@progbits
+	.globl f
+f:
+	leaq s(%rip), %rax
+	ret
+
+	.section .text.g,"ax",@progbits
+	.globl g
+g:
+	leaq s(%rip), %rax
+	ret
+
+	.section .text.h1,"ax",@progbits
+h1:
+	call k1
+	ret
+
+	.section .text.k1,"ax",@progbits
+k1:
+	call h1
+	ret
+
+	.section .text.h2,"ax",@progbits
+h2:
+	call k2
+	ret
+
+	.section .text.k2,"ax",@progbits
+k2:
+	call h2
+	ret
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+s:	.asciz "x"
+EOF
+
+./rvld -m elf_x86_64 -q --icf=all --print-icf-sections "$t"/a.o -o "$t"/out > "$t"/log
+grep -q 'removing identical section .*(.text.g)' "$t"/log
+grep -q 'removing identical section .*(.text.h2)' "$t"/log
+grep -q 'removing identical section .*(.text.k2)' "$t"/log
+
+addr() { readelf -s "$t"/out | awk -v n="$1" '$8 == n { print $2 }'; }
+[ -n "$(addr f)" ]
+[ "$(addr f)" = "$(addr g)" ]
+
+# Without an address-significance table, nothing is safe to fold.
+./rvld -m elf_x86_64 --icf=safe --print-icf-sections "$t"/a.o -o "$t"/out2 \
+	> "$t"/log2 2> "$t"/err2
+[ ! -s "$t"/log2 ]
+grep -q 'no input has an .llvm_addrsig section' "$t"/err2
+
+# With the table, only sections whose address is taken are kept.
+cat <<'EOF2' | llvm-mc -triple=x86_64-linux-gnu -filetype=obj -o "$t"/b.o -
+	.section .text._start,"ax",@progbits
+	.globl _start
+_start:
+	call f
+	call g
+	call h
+	ret
+
+	.section .text.f,"ax",@progbits
+	.globl f
+f:
+	movl $1, %eax
+	ret
+
+	.section .text.g,"ax",@progbits
+	.globl g
+g:
+	movl $1, %eax
+	ret
+
+	.section .text.h,"ax",@progbits
+	.globl h
+h:
+	movl $1, %eax
+	ret
+
+	.section .note.GNU-stack,"",@progbits
+	.addrsig
+	.addrsig_sym f
+EOF2
+
+./rvld -m elf_x86_64 --icf=safe --print-icf-sections "$t"/b.o -o "$t"/out3 \
+	> "$t"/log3 2> "$t"/err3
+[ ! -s "$t"/err3 ]
+grep -q 'removing identical section .*(.text.h)' "$t"/log3
+if grep -q '(.text.f)' "$t"/log3; then
+	exit 1
+fi
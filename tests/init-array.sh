@@ -0,0 +1,56 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	leaq __init_array_start(%rip), %rax
+	leaq __init_array_end(%rip), %rbx
+	ret
+
+	.section .ctors,"aw"
+	.quad 0xc1
+	.quad 0xc2
+	.section .ctors.65435,"aw"
+	.quad 0x100
+	.section .init_array,"aw"
+	.quad 0x11
+	.section .init_array.00200,"aw"
+	.quad 0x200
+	.section .dtors,"aw"
+	.quad 0xd1
+	.quad 0xd2
+	.section .fini_array,"aw"
+	.quad 0xf1
+EOF
+
+cat <<'EOF' | as -o "$t"/b.o -
+	.section .ctors,"aw"
+	.quad 0xc3
+EOF
+
+./rvld -m elf_x86_64 -q "$t"/a.o "$t"/b.o -o "$t"/out
+
+readelf -S "$t"/out > "$t"/sections
+if grep -Eq '\.(ctors|dtors)' "$t"/sections; then
+	exit 1
+fi
+
+# .ctors.65435 has priority 100, and each .ctors or .dtors table
+# is reversed where it lands, as GNU ld does.
+readelf -x .init_array "$t"/out | tr -d '\n' | grep -Eq \
+	'00010000 00000000 00020000 00000000.*c2000000 00000000 c1000000 00000000.*11000000 00000000 c3000000 00000000'
+readelf -x .fini_array "$t"/out | tr -d '\n' | grep -Eq \
+	'd2000000 00000000 d1000000 00000000.*f1000000 00000000'
+
+start=$(readelf -S "$t"/out |
+	awk '{ for (i = 1; i < NF; i++) if ($i == ".init_array") print $(i + 2) }')
+[ -n "$start" ]
+readelf -s "$t"/out | grep -Eq "$start .* __init_array_start$"
@@ -0,0 +1,98 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+s=$t/sysroot
+
+rm -rf "$t"
+mkdir -p "$t" "$s"/usr/lib "$s"/usr/lib/x86_64-linux-gnu "$t"/empty
+
+cat <<'EOF2' | as -o "$t"/main.o -
+	.text
+	.globl _start
+_start:
+	call get
+	movq %rax, %rdi
+	movq $60, %rax
+	syscall
+EOF2
+
+cat <<'EOF2' | as -o "$t"/get.o -
+	.text
+	.globl get
+get:
+	movq $4, %rax
+	ret
+EOF2
+
+ar rcs "$s"/usr/lib/libfoo.a "$t"/get.o
+gcc -shared -nostdlib -o "$s"/usr/lib/libfoo.so "$t"/get.o
+ar rcs "$s"/usr/lib/x86_64-linux-gnu/libbar.a "$t"/get.o
+
+cat <<'EOF2' > "$s"/usr/lib/libscript.a
+/* Like glibc's libc.so */
+OUTPUT_FORMAT(elf64-x86-64)
+GROUP ( /usr/lib/libfoo.a AS_NEEDED ( =/usr/lib/x86_64-linux-gnu/libbar.a ) )
+EOF2
+
+run() {
+	set +e
+	"$1"
+	status=$?
+	set -e
+	[ $status -eq 4 ]
+}
+
+link() {
+	./rvld -m elf_x86_64 --sysroot="$s" "$t"/main.o -o "$t"/out "$@"
+}
+
+# rvld can't link against a shared object, so the archive next to it
+# is used instead, with a warning.
+link -L=/usr/lib -lfoo > "$t"/log 2>&1
+run "$t"/out
+grep -q "using $s/usr/lib/libfoo.a instead of $s/usr/lib/libfoo.so" "$t"/log
+
+# A shared object on its own is still found, and rejected.
+mkdir -p "$t"/shared
+cp "$s"/usr/lib/libfoo.so "$t"/shared
+link -L"$t"/shared -lfoo > "$t"/log 2>&1 && exit 1
+grep -q 'libfoo.so: shared libraries are not supported' "$t"/log
+
+link -L'$SYSROOT'/usr/lib -Bstatic -lfoo
+run "$t"/out
+
+link -L=/usr/lib --push-state -static -lfoo --pop-state
+run "$t"/out
+
+link -L=/usr/lib -l:libfoo.a
+run "$t"/out
+
+# Default directories are within the sysroot.
+link -lbar
+run "$t"/out
+
+# A linker script in the sysroot refers to files in the sysroot.
+link -L=/usr/lib -Bstatic -lscript
+run "$t"/out
+
+./rvld -m elf_x86_64 -nostdlib -L"$t"/empty "$t"/main.o -o "$t"/out \
+	-lmissing > "$t"/log 2>&1 && exit 1
+grep -q 'library not found' "$t"/log
+grep -q "$t/empty/libmissing.so" "$t"/log
+grep -q "$t/empty/libmissing.a" "$t"/log
+if grep -q '/usr/lib/libmissing' "$t"/log; then
+	exit 1
+fi
+
+# Without a sysroot, /usr/lib holds libraries of the host, so it is
+# only searched when linking for the host.
+./rvld -m elf64lriscv "$t"/main.o -o "$t"/out -lmissing > "$t"/log 2>&1 && exit 1
+grep -q '/usr/lib/riscv64-linux-gnu/libmissing.a' "$t"/log
+if grep -q '^	/usr/lib/libmissing' "$t"/log; then
+	exit 1
+fi
+./rvld -m elf_x86_64 "$t"/main.o -o "$t"/out -lmissing > "$t"/log 2>&1 && exit 1
+grep -q '^	/usr/lib/libmissing.a' "$t"/log
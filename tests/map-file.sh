@@ -0,0 +1,76 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+mkdir -p "$t"
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	call helper
+	ret
+
+	.section .text.helper,"ax",@progbits
+	.globl helper
+helper:
+	ret
+
+	.section .data.foo,"awG",@progbits,foo,comdat
+	.globl foo
+foo:
+	.quad 1
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+	.asciz "hello"
+	.asciz "world"
+
+	.section .note.GNU-stack,"",@progbits
+EOF2
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/b.o -
+	.section .data.foo,"awG",@progbits,foo,comdat
+	.globl foo
+foo:
+	.quad 2
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+	.asciz "hello"
+
+	.section .note.GNU-stack,"",@progbits
+EOF2
+
+./rvld -q -Map="$t"/map "$t"/a.o "$t"/b.o -o "$t"/out
+./rvld -q -M "$t"/a.o "$t"/b.o -o "$t"/out2 > "$t"/stdout
+cmp "$t"/map "$t"/stdout
+
+head -1 "$t"/map | grep -q 'VMA *LMA *Size Align Out     In      Symbol'
+
+# Output sections, their members and the symbols in them, at the
+# addresses in the output. Without a linker script, LMA equals VMA.
+addr() {
+	llvm-readelf -sW "$t"/out | awk -v n="$1" '$8 == n { print $2 }'
+}
+text=$(llvm-readelf -SW "$t"/out | sed 's/^ *\[ *[0-9]*\]//' |
+	awk '$1 == ".text" { print $3 }')
+[ -n "$text" ]
+grep -Eq "^$text $text [0-9a-f]{8} +4 \.text$" "$t"/map
+grep -Eq "^$text $text .*$t/a.o:\(\.text\) \+0x0$" "$t"/map
+grep -Eq "^$(addr _start) +_start$" "$t"/map
+grep -Eq "^$(addr helper) +helper$" "$t"/map
+grep -Eq "$t/a.o:\(\.text\.helper\)" "$t"/map
+grep -Eq "^$(addr foo) +foo$" "$t"/map
+
+# Merged sections report how many pieces they were made from.
+grep -q '<merged: 2 input sections, 3 pieces, 2 unique, 0x12 -> 0xc bytes>' "$t"/map
+
+# The copy of a COMDAT group that lost is listed as discarded.
+sed -n '/^Discarded input sections$/,$p' "$t"/map > "$t"/discarded
+grep -q "^00000008 $t/b.o:(.data.foo) \[comdat\]$" "$t"/discarded
+if grep -q "a.o:(.data.foo)" "$t"/discarded; then
+	exit 1
+fi
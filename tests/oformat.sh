@@ -0,0 +1,76 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+mkdir -p "$t"
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	lui a0, %hi(msg)
+	addi a0, a0, %lo(msg)
+	li a7, 93
+	ecall
+
+	.section .rodata,"a",@progbits
+msg:	.asciz "Hello"
+
+	.data
+	.p2align 3
+val:	.dword 0x1122334455667788
+
+	.bss
+	.zero 64
+
+	.section .note.GNU-stack,"",@progbits
+EOF2
+
+./rvld "$t"/a.o -o "$t"/out
+llvm-objcopy -O binary "$t"/out "$t"/ref.bin
+entry=$(printf '%08X' "$(llvm-readelf -h "$t"/out | awk '/Entry/ { print $4 }')")
+
+# The images hold the loadable segments at their physical addresses,
+# without the headers, so they match objcopy's.
+./rvld --oformat=binary "$t"/a.o -o "$t"/out.bin
+cmp "$t"/out.bin "$t"/ref.bin
+
+./rvld --oformat=ihex "$t"/a.o -o "$t"/out.hex
+objcopy -I ihex -O binary "$t"/out.hex "$t"/hex.bin
+cmp "$t"/hex.bin "$t"/ref.bin
+grep -q "^:04000005$entry" "$t"/out.hex
+tail -1 "$t"/out.hex | grep -q '^:00000001FF'
+
+./rvld --oformat=srec "$t"/a.o -o "$t"/out.srec
+objcopy -I srec -O binary "$t"/out.srec "$t"/srec.bin
+cmp "$t"/srec.bin "$t"/ref.bin
+grep -q "^S705$entry" "$t"/out.srec
+
+# --gap-fill only changes the bytes between segments.
+./rvld --oformat=binary --gap-fill=0xff "$t"/a.o -o "$t"/gap.bin
+cmp -l "$t"/gap.bin "$t"/ref.bin > "$t"/diff || true
+[ -s "$t"/diff ]
+if awk '$2 != 377 || $3 != 0' "$t"/diff | grep -q .; then
+	exit 1
+fi
+
+# ELF output can be named by its BFD target.
+./rvld --oformat=elf64-littleriscv "$t"/a.o -o "$t"/out2
+cmp "$t"/out "$t"/out2
+
+if ./rvld --oformat=elf32-bogus "$t"/a.o -o "$t"/out3 > "$t"/log 2>&1; then
+	exit 1
+fi
+grep -q 'unknown --oformat argument: elf32-bogus' "$t"/log
+
+echo '.globl _start; _start: ret; .section .note.GNU-stack,"",@progbits' |
+	as -o "$t"/x86.o -
+./rvld -m elf_x86_64 --oformat=elf64-x86-64 "$t"/x86.o -o "$t"/x86
+
+echo '.globl _start; _start: ret; .section .note.GNU-stack,"",@progbits' |
+	$MC -triple=riscv32 -filetype=obj -o "$t"/rv32.o -
+./rvld --oformat=elf32-littleriscv "$t"/rv32.o -o "$t"/rv32
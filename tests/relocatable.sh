@@ -0,0 +1,51 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	call f
+	movq msg@GOTPCREL(%rip), %rsi
+	movq len(%rip), %rdx
+	movl $1, %eax
+	movl $1, %edi
+	syscall
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+msg:	.asciz "Hello, World\n"
+
+	.data
+len:	.quad 13
+EOF
+
+cat <<'EOF' | as -o "$t"/b.o -
+	.section .text.f,"axG",@progbits,f,comdat
+	.globl f
+	.weak f
+f:
+	leaq s(%rip), %rax
+	ret
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+s:	.asciz "xyz"
+EOF
+
+./rvld -m elf_x86_64 -r "$t"/a.o "$t"/b.o -o "$t"/ab.o
+readelf -h "$t"/ab.o | grep -q 'REL (Relocatable file)'
+readelf -g "$t"/ab.o | grep -q 'COMDAT group section \[.*\] `.group'"'"' \[f\]'
+
+ld "$t"/ab.o "$t"/b.o -o "$t"/out
+"$t"/out | grep -q 'Hello, World'
+
+./rvld -m elf_x86_64 "$t"/ab.o -o "$t"/out2
+readelf -h "$t"/out2 | grep -q 'EXEC (Executable file)'
@@ -0,0 +1,82 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+asm() {
+	name=$1
+	shift
+	(cat; echo '.section .note.GNU-stack,"",@progbits') |
+		$MC -triple=riscv64 -filetype=obj "$@" -o "$t/$name" -
+}
+
+asm a.o <<'EOF2'
+	.attribute arch, "rv64i2p0_m2p0"
+	.attribute stack_align, 16
+	.attribute priv_spec, 1
+	.globl _start
+_start:
+	ret
+EOF2
+
+asm b.o <<'EOF2'
+	.attribute arch, "rv64i2p0_a2p0_c2p0"
+	.attribute stack_align, 16
+	.attribute unaligned_access, 1
+	.attribute priv_spec, 1
+	.attribute priv_spec_minor, 11
+	nop
+EOF2
+
+asm no-attrs.o <<'EOF2'
+	nop
+EOF2
+
+asm align8.o <<'EOF2'
+	.attribute stack_align, 8
+	nop
+EOF2
+
+asm rv32.o <<'EOF2'
+	.attribute arch, "rv32i2p0"
+	nop
+EOF2
+
+asm double.o -mattr=+d -target-abi=lp64d <<'EOF2'
+	nop
+EOF2
+
+# Extensions are merged and the other
+# attributes combined; files without attributes don't matter.
+./rvld "$t"/a.o "$t"/no-attrs.o "$t"/b.o -o "$t"/out 2> "$t"/log
+llvm-readelf -A "$t"/out > "$t"/attrs
+grep -A2 'TagName: arch' "$t"/attrs | grep -q 'Value: rv64i2p0_m2p0_a2p0_c2p0'
+grep -B1 'TagName: stack_align' "$t"/attrs | grep -q 'Value: 16'
+grep -B1 'TagName: unaligned_access' "$t"/attrs | grep -q 'Value: 1'
+grep -A1 'TagName: priv_spec_minor' "$t"/attrs | grep -q 'Value: 11'
+llvm-readelf -lW "$t"/out | grep -Eq '^ +[0-9]+ +\.riscv\.attributes $'
+
+# Differing privileged spec versions only warn.
+grep -q 'b.o: privileged spec version 1.11.0 differs from 1.0.0 of .*a.o' "$t"/log
+
+fails() {
+	msg=$1
+	shift
+	if ./rvld "$@" -o "$t"/bad > "$t"/log 2>&1; then
+		exit 1
+	fi
+	grep -q "$msg" "$t"/log
+}
+
+fails 'align8.o: stack alignment 8 is incompatible with 16 of .*a.o' \
+	"$t"/a.o "$t"/align8.o
+fails 'rv32.o: XLEN 32 is incompatible with 64 of .*a.o' \
+	"$t"/a.o "$t"/rv32.o
+fails 'double.o: float ABI double-float is incompatible with soft-float of .*a.o' \
+	"$t"/a.o "$t"/double.o
@@ -0,0 +1,78 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+cat <<'EOF2' | $MC -triple=riscv32 -filetype=obj -o "$t"/a.o -
+	.globl _start
+_start:
+	lla a0, val
+	lw a1, 0(a0)
+	beqz a1, get
+	j get
+
+	.section .text.get,"ax",@progbits
+	.globl get
+get:
+	li a7, 93
+	ecall
+
+	.data
+	.globl val, ptr
+val:	.word 42
+ptr:	.word get
+
+	.section .note.GNU-stack,"",@progbits
+EOF2
+
+echo '.globl _start; _start: ret' |
+	$MC -triple=riscv64 -filetype=obj -o "$t"/rv64.o -
+
+./rvld -q "$t"/a.o -o "$t"/out
+./rvld -q -m elf32lriscv "$t"/a.o -o "$t"/out2
+cmp "$t"/out "$t"/out2
+
+llvm-readelf -h "$t"/out > "$t"/header
+grep -q 'Class: *ELF32' "$t"/header
+grep -q 'Machine: *RISC-V' "$t"/header
+grep -q 'Type: *EXEC' "$t"/header
+
+addr() {
+	printf '%d' 0x$(llvm-readelf -s "$t"/out | awk -v n="$1" '$8 == n { print $2 }')
+}
+
+# PCREL_HI20/LO12_I: auipc and addi add up to the address of val.
+llvm-objdump -d --no-show-raw-insn "$t"/out > "$t"/disasm
+start=$(addr _start)
+hi=$(awk '/auipc/ { sub(/.*, /, ""); print; exit }' "$t"/disasm)
+lo=$(awk '/addi/ { sub(/.*, /, ""); print; exit }' "$t"/disasm)
+[ $((start + (hi << 12) + lo)) -eq "$(addr val)" ]
+
+# BRANCH and JAL reach get.
+get=$(printf '%x' "$(addr get)")
+[ "$(grep -Ec "(beqz|j)[[:space:]].*0x$get" "$t"/disasm)" -eq 2 ]
+
+# R_RISCV_32 stores the address of get.
+ptr=$(llvm-readelf -x .data "$t"/out | awk 'NR == 2 { print $3 }')
+[ "$((0x${ptr:6:2}${ptr:4:2}${ptr:2:2}${ptr:0:2}))" -eq "$(addr get)" ]
+
+# A partial link stays ELF32.
+./rvld -r "$t"/a.o -o "$t"/c.o
+llvm-readelf -h "$t"/c.o | grep -q 'Class: *ELF32'
+llvm-readelf -h "$t"/c.o | grep -q 'Type: *REL'
+
+if ./rvld "$t"/a.o "$t"/rv64.o -o "$t"/bad > "$t"/log 2>&1; then
+	exit 1
+fi
+grep -q 'rv64.o: incompatible file type' "$t"/log
+
+if ./rvld -m elf32lriscv "$t"/rv64.o -o "$t"/bad > "$t"/log 2>&1; then
+	exit 1
+fi
+grep -q 'rv64.o: incompatible file type' "$t"/log
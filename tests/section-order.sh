@@ -0,0 +1,55 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.section .text._start,"ax",@progbits
+	.globl _start
+_start:
+	call c
+	ret
+
+	.section .text.a,"ax",@progbits
+	.globl a
+a:
+	ret
+
+	.section .text.b,"ax",@progbits
+	.p2align 4
+	.globl b
+b:
+	ret
+
+	.section .text.c,"ax",@progbits
+c:
+	ret
+
+	.section .init_array.200,"aw"
+	.quad 200
+	.section .init_array,"aw"
+	.quad 65536
+	.section .init_array.00100,"aw"
+	.quad 100
+EOF
+
+printf 'c # hot\n\nmissing\nb\n' > "$t"/sym.txt
+printf '.text.a\n' > "$t"/sec.txt
+
+addr() { readelf -s "$1" | awk -v n="$2" '$8 == n { print $2 }'; }
+
+./rvld -m elf_x86_64 -q --symbol-ordering-file="$t"/sym.txt \
+	--section-ordering-file="$t"/sec.txt "$t"/a.o -o "$t"/out 2> "$t"/log
+grep -q 'no such symbol: missing' "$t"/log
+[[ "$(addr "$t"/out c)" < "$(addr "$t"/out b)" ]]
+[[ "$(addr "$t"/out b)" < "$(addr "$t"/out a)" ]]
+[[ "$(addr "$t"/out a)" < "$(addr "$t"/out _start)" ]]
+
+./rvld -m elf_x86_64 -q --sort-section=alignment "$t"/a.o -o "$t"/out2
+[[ "$(addr "$t"/out2 b)" < "$(addr "$t"/out2 _start)" ]]
+
+readelf -x .init_array "$t"/out | grep -Eq '64000000 00000000 c8000000 00000000'
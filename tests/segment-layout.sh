@@ -0,0 +1,52 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF2' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	movq dat(%rip), %rdi
+	movq buf+9992(%rip), %rax
+	addq %rax, %rdi
+	movl $60, %eax
+	syscall
+
+	.section .rodata
+	.quad 1
+
+	.data
+dat:	.quad 3
+
+	.bss
+buf:	.zero 10000
+EOF2
+
+# Every PT_LOAD must have p_offset and p_vaddr congruent modulo p_align.
+check_loads() {
+	readelf -lW "$1" | grep LOAD | while read -r _ off vaddr _ _ _ rest; do
+		align=${rest##* }
+		[ $((off % align)) = $((vaddr % align)) ]
+	done
+}
+
+./rvld -m elf_x86_64 "$t"/a.o -o "$t"/out
+check_loads "$t"/out
+set +e; "$t"/out; status=$?; set -e
+[ "$status" = 3 ]
+
+# .bss takes no space in the file.
+size=$(stat -c %s "$t"/out)
+[ "$size" -lt 10000 ]
+
+./rvld -m elf_x86_64 -z max-page-size=0x10000 -z common-page-size=0x1000 \
+	"$t"/a.o -o "$t"/out2
+check_loads "$t"/out2
+readelf -lW "$t"/out2 | grep -Eq 'LOAD .* R E 0x10000'
+set +e; "$t"/out2; status=$?; set -e
+[ "$status" = 3 ]
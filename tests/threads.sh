@@ -0,0 +1,81 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+MC=${MC:-llvm-mc}
+
+rm -rf "$t"
+mkdir -p "$t"
+
+# Enough files, symbols, strings and COMDAT groups that the parallel
+# passes split the work between many goroutines.
+for i in $(seq 0 63); do
+	cat <<EOF2 | $MC -triple=riscv64 -filetype=obj -o "$t/f$i.o" -
+	.section .text.f$i,"ax",@progbits
+	.globl f$i
+f$i:
+	lui a0, %hi(str$i)
+	addi a0, a0, %lo(str$i)
+	call common
+	call f$(( (i + 1) % 64 ))
+	ret
+
+	.section .text.same$i,"ax",@progbits
+same$i:
+	li a0, 1
+	ret
+
+	.section .text.common,"axG",@progbits,common,comdat
+	.globl common
+common:
+	li a0, $i
+	ret
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+str$i:
+	.asciz "string $i"
+	.asciz "shared"
+
+	.data
+	.globl data$i
+data$i:
+	.quad f$i
+	.quad str$i
+
+	.section .note.GNU-stack,"",@progbits
+EOF2
+done
+
+cat <<'EOF2' | $MC -triple=riscv64 -filetype=obj -o "$t"/main.o -
+	.globl _start
+_start:
+	call f0
+	ret
+	.section .note.GNU-stack,"",@progbits
+EOF2
+
+ar rcs "$t"/lib.a "$t"/f3*.o "$t"/f4*.o "$t"/f5*.o "$t"/f6*.o
+
+objs=$(ls "$t"/f[0-2]*.o "$t"/f[7-9]*.o)
+
+link() {
+	./rvld -q --icf=all --build-id=sha1 "$t"/main.o $objs "$t"/lib.a \
+		-Map="$t/map$1" -o "$t/out$1" --threads="$1"
+}
+
+link 1
+for n in 2 3 8 64; do
+	link $n
+	cmp "$t"/out1 "$t/out$n"
+	cmp "$t"/map1 "$t/map$n"
+done
+
+./rvld -q --icf=all --build-id=sha1 "$t"/main.o $objs "$t"/lib.a \
+	-o "$t"/out-no-threads --no-threads
+cmp "$t"/out1 "$t"/out-no-threads
+
+./rvld -q --icf=all --build-id=sha1 "$t"/main.o $objs "$t"/lib.a \
+	-o "$t"/out-default
+cmp "$t"/out1 "$t"/out-default
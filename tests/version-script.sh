@@ -0,0 +1,158 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF2' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	call qux
+	movq %rax, %rdi
+	movq $60, %rax
+	syscall
+
+	.globl foo, bar, baz_1, keep_me, hid
+foo:
+bar:
+baz_1:
+keep_me:
+hid:
+	ret
+EOF2
+
+cat <<'EOF2' | as -o "$t"/b.o -
+	.text
+	.globl qux_v1, qux_v2
+	.symver qux_v1, qux@VER_1
+	.symver qux_v2, qux@@VER_2
+qux_v1:
+	movq $3, %rax
+	ret
+qux_v2:
+	movq $7, %rax
+	ret
+
+	.hidden hid
+	.protected prot
+	.globl prot
+prot:
+	call hid
+	ret
+EOF2
+
+cat <<'EOF2' > "$t"/script
+/* Patterns, labels, a dependency and an extern block */
+VER_1 {
+	global: _start; foo; ba?; prot;
+	local: *;
+};
+VER_2 {
+	global:
+		qux;
+		extern "C" { keep*; };
+} VER_1;
+EOF2
+
+./rvld -m elf_x86_64 -q "$t"/a.o "$t"/b.o -o "$t"/out \
+	--version-script="$t"/script -E -Bsymbolic 2> "$t"/warnings
+if grep -v 'GNU-stack' "$t"/warnings; then
+	exit 1
+fi
+
+# qux@@VER_2 is the default version, so the call goes to qux_v2.
+set +e
+"$t"/out
+status=$?
+set -e
+[ $status -eq 7 ]
+
+readelf -sW "$t"/out | sed -n '/\.symtab/,$p' > "$t"/symbols
+grep -Eq 'GLOBAL +DEFAULT .* foo$' "$t"/symbols
+grep -Eq 'GLOBAL +DEFAULT .* bar$' "$t"/symbols
+grep -Eq 'LOCAL +DEFAULT .* baz_1$' "$t"/symbols
+grep -Eq 'GLOBAL +DEFAULT .* keep_me$' "$t"/symbols
+grep -Eq 'GLOBAL +DEFAULT .* qux$' "$t"/symbols
+grep -Eq 'GLOBAL +DEFAULT .* qux@VER_1$' "$t"/symbols
+grep -Eq 'LOCAL +HIDDEN .* hid$' "$t"/symbols
+grep -Eq 'GLOBAL +PROTECTED .* prot$' "$t"/symbols
+
+# Locals come before every global.
+info=$(readelf -SW "$t"/out | grep ' \.symtab ' | awk '{ print $(NF - 1) }')
+[ -n "$info" ]
+awk -v info="$info" '$1 ~ /^[0-9]+:$/ {
+	idx = substr($1, 1, length($1) - 1) + 0
+	if (($5 == "LOCAL") != (idx < info)) exit 1
+}' "$t"/symbols
+
+# -E exports the global symbols with the versions of the script.
+# foo@VER names its version, and is hidden unless it's the default.
+readelf --dyn-syms -W "$t"/out > "$t"/dynsyms
+grep -Eq ' _start@@VER_1$' "$t"/dynsyms
+grep -Eq ' foo@@VER_1$' "$t"/dynsyms
+grep -Eq ' keep_me@@VER_2$' "$t"/dynsyms
+grep -Eq ' qux@VER_1$' "$t"/dynsyms
+grep -Eq ' qux@@VER_2$' "$t"/dynsyms
+grep -Eq 'PROTECTED .* prot@@VER_1$' "$t"/dynsyms
+if grep -Eq ' (baz_1|hid)(@|$)' "$t"/dynsyms; then
+	exit 1
+fi
+
+readelf -VW "$t"/out > "$t"/versions
+grep -q 'Name: out$' "$t"/versions
+grep -q 'Name: VER_1$' "$t"/versions
+grep -q 'Name: VER_2$' "$t"/versions
+grep -q 'Parent 1: VER_1$' "$t"/versions
+
+readelf -dW "$t"/out > "$t"/dynamic
+grep -q '(FLAGS) *SYMBOLIC' "$t"/dynamic
+grep -q '(VERDEFNUM) *3' "$t"/dynamic
+readelf -lW "$t"/out | grep -q ' DYNAMIC '
+
+# A dynamic list exports only what it names, and a symbol named with a
+# version that the version script doesn't define is an error.
+cat <<'EOF2' > "$t"/list
+{ foo; ba?; };
+EOF2
+./rvld -m elf_x86_64 "$t"/a.o -o "$t"/out3 --dynamic-list="$t"/list
+readelf --dyn-syms -W "$t"/out3 > "$t"/dynsyms
+grep -Eq ' foo$' "$t"/dynsyms
+grep -Eq ' bar$' "$t"/dynsyms
+if grep -Eq ' (_start|keep_me|baz_1)$' "$t"/dynsyms; then
+	exit 1
+fi
+readelf -SW "$t"/out3 | grep -q ' .hash '
+if readelf -SW "$t"/out3 | grep -q 'gnu.version'; then
+	exit 1
+fi
+
+if ./rvld -m elf_x86_64 -E "$t"/a.o "$t"/b.o -o "$t"/out4 > "$t"/err 2>&1; then
+	exit 1
+fi
+grep -q 'qux@VER_1: symbol has undefined version VER_1' "$t"/err
+
+# Without -E or a dynamic list, there's no dynamic symbol table.
+./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o -o "$t"/out5 \
+	--version-script="$t"/script
+if readelf -SW "$t"/out5 | grep -q '.dynsym'; then
+	exit 1
+fi
+
+# A partial link keeps hidden symbols global, with the merged
+# visibility.
+./rvld -m elf_x86_64 -r "$t"/a.o "$t"/b.o -o "$t"/c.o
+readelf -sW "$t"/c.o | grep -Eq 'GLOBAL +HIDDEN .* hid$'
+readelf -sW "$t"/c.o | grep -Eq 'qux@@VER_2$'
+
+cat <<'EOF2' > "$t"/bad
+VER_2 { global: foo; } VER_1;
+EOF2
+if ./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o -o "$t"/out2 \
+	--version-script="$t"/bad > "$t"/err 2>&1; then
+	exit 1
+fi
+grep -q 'unknown version dependency: VER_1' "$t"/err
@@ -0,0 +1,73 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF2' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	call malloc
+	addq $board_id, %rax
+	movq %rax, %rdi
+	movq $60, %rax
+	syscall
+EOF2
+
+cat <<'EOF2' | as -o "$t"/b.o -
+	.text
+	.globl __wrap_malloc
+__wrap_malloc:
+	call __real_malloc
+	addq $10, %rax
+	ret
+EOF2
+
+cat <<'EOF2' | as -o "$t"/c.o -
+	.text
+	.globl malloc
+malloc:
+	movq $5, %rax
+	ret
+
+	.globl board_id
+	.set board_id, 100
+EOF2
+
+# _start reaches malloc through __wrap_malloc, and __real_malloc is the
+# original. board_id is overridden by --defsym. -q keeps .symtab.
+./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out \
+	-q --wrap=malloc --defsym=board_id=0x20 \
+	--defsym alias=malloc --defsym 'after=alias+4' --defsym=before=malloc-1
+
+set +e
+"$t"/out
+status=$?
+set -e
+[ $status -eq $((5 + 10 + 0x20)) ]
+
+readelf -s "$t"/out > "$t"/symbols
+addr=$(awk '$NF == "malloc" { print $2 }' "$t"/symbols)
+[ -n "$addr" ]
+grep -Eq "$addr .* alias$" "$t"/symbols
+grep -Eq "$(printf '%016x' $((0x$addr + 4))) .* after$" "$t"/symbols
+grep -Eq "$(printf '%016x' $((0x$addr - 1))) .* before$" "$t"/symbols
+grep -Eq '0000000000000020 .* board_id$' "$t"/symbols
+
+# Without --wrap the call goes straight to malloc.
+./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out2
+set +e
+"$t"/out2
+status=$?
+set -e
+[ $status -eq $((5 + 100)) ]
+
+if ./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out3 \
+	--defsym=x=missing > "$t"/err 2>&1; then
+	exit 1
+fi
+grep -q 'undefined symbol: missing' "$t"/err
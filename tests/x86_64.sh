@@ -0,0 +1,33 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	movq msg@GOTPCREL(%rip), %rsi
+	movq len(%rip), %rdx
+	movl $1, %eax
+	movl $1, %edi
+	syscall
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+msg:	.asciz "Hello, World\n"
+
+	.data
+len:	.quad 13
+EOF
+
+./rvld -m elf_x86_64 "$t"/a.o -o "$t"/out
+readelf -h "$t"/out | grep -q 'Advanced Micro Devices X86-64'
+readelf -h "$t"/out | grep -q 'Entry point address: *0x4'
+"$t"/out | grep -q 'Hello, World'
@@ -0,0 +1,66 @@
+#!/bin/bash
+
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+
+mkdir -p "$t"
+
+cat <<'EOF' | as -o "$t"/a.o -
+	.text
+	.globl _start
+_start:
+	movq msg@GOTPCREL(%rip), %rsi
+	movq len(%rip), %rdx
+	movl $1, %eax
+	movl $1, %edi
+	syscall
+	movl $60, %eax
+	xorl %edi, %edi
+	syscall
+
+	.section .rodata.str1.1,"aMS",@progbits,1
+msg:	.asciz "Hello, World\n"
+
+	.data
+len:	.quad 13
+
+	.section .note.GNU-stack,"",@progbits
+EOF
+
+cat <<'EOF' | as -o "$t"/b.o -
+	.section .note.GNU-stack,"x",@progbits
+EOF
+
+./rvld -m elf_x86_64 -z separate-code "$t"/a.o -o "$t"/out
+"$t"/out | grep -q 'Hello, World'
+
+readelf -lW "$t"/out > "$t"/phdrs
+grep -Eq 'GNU_STACK .* RW  ' "$t"/phdrs
+grep -q 'GNU_RELRO' "$t"/phdrs
+grep -Eq 'LOAD +0x[0-9a-f]*000 .* R E 0x1000' "$t"/phdrs
+if readelf -SW "$t"/out | grep -q 'note.GNU-stack'; then
+	exit 1
+fi
+
+./rvld -m elf_x86_64 "$t"/a.o "$t"/b.o -o "$t"/out2
+readelf -lW "$t"/out2 | grep -Eq 'GNU_STACK .* RWE '
+
+./rvld -m elf_x86_64 -z noexecstack -z norelro "$t"/a.o "$t"/b.o -o "$t"/out3
+readelf -lW "$t"/out3 > "$t"/phdrs3
+grep -Eq 'GNU_STACK .* RW  ' "$t"/phdrs3
+if grep -q 'GNU_RELRO' "$t"/phdrs3; then
+	exit 1
+fi
+
+# An object without .note.GNU-stack may need an executable stack.
+echo '.globl foo; foo: ret' | as -o "$t"/c.o -
+./rvld -m elf_x86_64 "$t"/a.o "$t"/c.o -o "$t"/out4 2> "$t"/log4
+[ "$(grep -c 'c.o: missing .note.GNU-stack section implies executable stack' "$t"/log4)" -eq 1 ]
+readelf -lW "$t"/out4 | grep -Eq 'GNU_STACK .* RWE '
+
+./rvld -m elf_x86_64 -z noexecstack -z now -z lazy "$t"/a.o "$t"/c.o \
+	-o "$t"/out5 2> "$t"/log5
+[ ! -s "$t"/log5 ]
+readelf -lW "$t"/out5 | grep -Eq 'GNU_STACK .* RW  '